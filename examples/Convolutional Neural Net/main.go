@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	u "github.com/zaviermiller/zml/utils"
+	"github.com/zaviermiller/zml/zdnn"
+)
+
+func main() {
+	dataSet, err := u.ReadTrainSet("data")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// LeNet-5 style: two rounds of convolution and pooling, then dense layers
+	layers := []zdnn.Layer{}
+	add := func(layer zdnn.Layer, err error) {
+		if err != nil {
+			log.Fatal(err)
+		}
+		layers = append(layers, layer)
+	}
+	add(zdnn.NewConv2D(zdnn.Conv2DConfig{Filters: 6, Kernel: [2]int{5, 5}, Padding: [2]int{2, 2}, Initializer: zdnn.HeNormal{}}))
+	add(zdnn.NewActivationLayer(zdnn.ReLU.String()))
+	add(zdnn.NewMaxPool2D(zdnn.PoolConfig{Size: [2]int{2, 2}}))
+	add(zdnn.NewConv2D(zdnn.Conv2DConfig{Filters: 16, Kernel: [2]int{5, 5}, Initializer: zdnn.HeNormal{}}))
+	add(zdnn.NewActivationLayer(zdnn.ReLU.String()))
+	add(zdnn.NewMaxPool2D(zdnn.PoolConfig{Size: [2]int{2, 2}}))
+	add(zdnn.NewFlatten(), nil)
+	add(zdnn.NewLayer(zdnn.LayerConfig{Neurons: 120, Activation: zdnn.ReLU, Initializer: zdnn.HeNormal{}}))
+	add(zdnn.NewLayer(zdnn.LayerConfig{Neurons: 84, Activation: zdnn.ReLU, Initializer: zdnn.HeNormal{}}))
+	outputLayer, err := zdnn.NewLayer(zdnn.LayerConfig{Neurons: 10, Activation: zdnn.Softmax})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	cnn, err := zdnn.NewNetwork(zdnn.NNConfig{
+		InputShape:   zdnn.Shape{Channels: 1, Height: dataSet.H, Width: dataSet.W},
+		HiddenLayers: layers,
+		OutputLayer:  outputLayer,
+		NumEpochs:    2,
+		LearningRate: .001,
+		LossFunc:     zdnn.CrossEntropy,
+		BatchSize:    32,
+		Optimizer:    zdnn.NewAdam(),
+		Workers:      4,
+		Prefetch:     2,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	t1 := time.Now()
+	fmt.Println("Beginning to train...")
+
+	if err := cnn.Train(dataSet); err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println(fmt.Sprintf("done in %s! testing...", time.Since(t1)))
+
+	testSet, err := u.ReadTestSet("data")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var acc int
+	for j := 0; j < testSet.Len(); j++ {
+		img, _ := testSet.Get(j)
+		outputs, err := cnn.Predict(img)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		best := 0
+		for i := 1; i < 10; i++ {
+			if outputs.At(i, 0) > outputs.At(best, 0) {
+				best = i
+			}
+		}
+		if best == testSet.Data[j].Digit {
+			acc++
+		}
+	}
+
+	fmt.Print("Accuracy: ")
+	fmt.Println(float64(acc) / float64(testSet.N))
+}
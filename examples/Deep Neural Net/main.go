@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"log"
+	"os"
 	"time"
 
 	// "sync"
@@ -37,8 +38,18 @@ func main() {
 
 	// set up deep neural nets layers and config
 	layercfg := zdnn.LayerConfig{Neurons: 20, Activation: zdnn.Sigmoid}
-	outputLayer := zdnn.NewLayer(zdnn.LayerConfig{Neurons: 10, Activation: zdnn.Sigmoid})
-	layers := []*zdnn.NeuronLayer{zdnn.NewLayer(layercfg), zdnn.NewLayer(layercfg)}
+	outputLayer, err := zdnn.NewLayer(zdnn.LayerConfig{Neurons: 10, Activation: zdnn.Sigmoid})
+	if err != nil {
+		log.Fatal(err)
+	}
+	layers := []zdnn.Layer{}
+	for i := 0; i < 2; i++ {
+		layer, err := zdnn.NewLayer(layercfg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		layers = append(layers, layer)
+	}
 	dcfg := zdnn.NNConfig{
 		InputNeurons: dataSet.H * dataSet.W,
 		HiddenLayers: layers,
@@ -50,34 +61,17 @@ func main() {
 	}
 
 	// build the network
-	dnn := zdnn.NewNetwork(dcfg)
-
-	// format data
-	digitsData := make([][]float64, dataSet.N)
-	inputsData := [][]float64{}
-	for i, img := range dataSet.Data {
-		digArr := make([]float64, 10)
-		for i := range digArr {
-			if (img.Digit) == i {
-				digArr[i] = 1.0
-				continue
-			}
-			digArr[i] = 0.0
-		}
-		digitsData[i] = digArr
-		tmp := []float64{}
-		for _, row := range img.Image {
-			for _, val := range row {
-				tmp = append(tmp, (float64(val) / 255.0 * 1.0))
-			}
-		}
-		inputsData = append(inputsData, tmp)
+	dnn, err := zdnn.NewNetwork(dcfg)
+	if err != nil {
+		log.Fatal(err)
 	}
 
 	t1 := time.Now()
 	fmt.Println("Beginning to train...")
 
-	dnn.Train(inputsData, digitsData, dataSet.N)
+	if err := dnn.Train(dataSet); err != nil {
+		log.Fatal(err)
+	}
 
 	fmt.Println(fmt.Sprintf("done in %s! testing...", time.Since(t1)))
 
@@ -85,21 +79,9 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	testLabels := make([]float64, testSet.N)
-	testData := [][]float64{}
-	for i, img := range testSet.Data {
-		testLabels[i] = float64(img.Digit)
-		tmp := []float64{}
-		for _, row := range img.Image {
-			for _, val := range row {
-				tmp = append(tmp, (float64(val) / 255.0))
-			}
-		}
-		testData = append(testData, tmp)
-	}
-
 	var acc int
-	for j, img := range testData {
+	for j := 0; j < testSet.Len(); j++ {
+		img, _ := testSet.Get(j)
 		outputs, err := dnn.Predict(img)
 		if err != nil {
 			log.Fatal(err)
@@ -113,8 +95,7 @@ func main() {
 				highest = outputs.At(i, 0)
 			}
 		}
-		target := testLabels[j]
-		if float64(best) == target {
+		if best == testSet.Data[j].Digit {
 			acc++
 		} else {
 			// fmt.Println(fmt.Sprintf("INCORRECT GUESS %d for number %d", best, target))
@@ -122,8 +103,17 @@ func main() {
 	}
 
 	fmt.Print("Accuracy: ")
-	fmt.Println(float64(acc) / float64(len(testData)))
+	fmt.Println(float64(acc) / float64(testSet.N))
 
 	// mlp.Save()
 
+	f, err := os.Create("data/zdnn.model")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	if err := dnn.Save(f); err != nil {
+		log.Fatal(err)
+	}
+
 }
@@ -9,7 +9,7 @@ require (
 	github.com/sethgrid/multibar v0.0.0-20160417171508-4bf4cf7b87d6
 	github.com/tredoe/term v0.0.0-20161130133337-e551c64f56c0 // indirect
 	golang.org/x/sync v0.0.0-20201207232520-09787c993a3a // indirect
-	golang.org/x/sys v0.0.0-20210108172913-0df2131ae363 // indirect
+	golang.org/x/sys v0.0.0-20210108172913-0df2131ae363
 	golang.org/x/tools v0.0.0-20210108195828-e2f9c7f1fc8e // indirect
 	golang.org/x/tools/gopls v0.6.2 // indirect
 	gonum.org/v1/gonum v0.8.2
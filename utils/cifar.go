@@ -0,0 +1,120 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CIFAR images are 32x32 in 3 channels: red, green, then blue
+const (
+	cifarSize     = 32
+	cifarChannels = 3
+	cifarPixels   = cifarChannels * cifarSize * cifarSize
+)
+
+// labels of the CIFAR-10 classes, if batches.meta.txt doesn't give them
+var cifar10Names = []string{"airplane", "automobile", "bird", "cat", "deer", "dog", "frog", "horse", "ship", "truck"}
+
+// ReadCIFAR10 reads the CIFAR-10 training set (data_batch_1.bin to
+// data_batch_5.bin) or test set (test_batch.bin) from dir, which holds the
+// binary version as unpacked from cifar-10-binary.tar.gz
+func ReadCIFAR10(dir string, train bool) (*DataSet, error) {
+	files := []string{"test_batch.bin"}
+	if train {
+		files = nil
+		for b := 1; b <= 5; b++ {
+			files = append(files, fmt.Sprintf("data_batch_%d.bin", b))
+		}
+	}
+	labelNames, e := cifarLabelNames(dir, "batches.meta.txt", cifar10Names)
+	if e != nil {
+		return nil, e
+	}
+	return readCIFAR(dir, files, 1, 0, labelNames)
+}
+
+// ReadCIFAR100 reads the CIFAR-100 training set (train.bin) or test set
+// (test.bin) from dir, which holds the binary version as unpacked from
+// cifar-100-binary.tar.gz. Images are labelled with their coarse class (one
+// of 20) if coarse is set, or their fine class (one of 100) if not
+func ReadCIFAR100(dir string, train, coarse bool) (*DataSet, error) {
+	file := "test.bin"
+	if train {
+		file = "train.bin"
+	}
+	namesFile, classes, label := "fine_label_names.txt", 100, 1
+	if coarse {
+		namesFile, classes, label = "coarse_label_names.txt", 20, 0
+	}
+	fallback := make([]string, classes)
+	for i := range fallback {
+		fallback[i] = fmt.Sprint(i)
+	}
+	labelNames, e := cifarLabelNames(dir, namesFile, fallback)
+	if e != nil {
+		return nil, e
+	}
+	return readCIFAR(dir, []string{file}, 2, label, labelNames)
+}
+
+// internal: read the CIFAR batch files in dir, whose records are labelBytes
+// of labels then the pixels, taking the label at index label
+func readCIFAR(dir string, files []string, labelBytes, label int, labelNames []string) (*DataSet, error) {
+	dataSet := &DataSet{W: cifarSize, H: cifarSize, Channels: cifarChannels, LabelNames: labelNames}
+	for _, file := range files {
+		e := readFile(findFile(dir, file), func(r io.Reader) error {
+			r, e := decompress(r)
+			if e != nil {
+				return e
+			}
+			record := make([]uint8, labelBytes+cifarPixels)
+			for i := 0; ; i++ {
+				_, e := io.ReadFull(r, record)
+				if e == io.EOF {
+					return nil
+				}
+				if e != nil {
+					return fmt.Errorf("reading image %d: %v", i, e)
+				}
+				digit := int(record[label])
+				if e := checkLabel(i, digit, len(labelNames)); e != nil {
+					return e
+				}
+				pixels := append([]uint8(nil), record[labelBytes:]...)
+				dataSet.Data = append(dataSet.Data, DigitImage{Digit: digit, Image: splitToRows(pixels, cifarChannels*cifarSize, cifarSize)})
+			}
+		})
+		if e != nil {
+			return nil, e
+		}
+	}
+	dataSet.N = len(dataSet.Data)
+	return dataSet, nil
+}
+
+// internal: the label names listed a line each in the file in dir, or
+// fallback if there's no such file
+func cifarLabelNames(dir, file string, fallback []string) ([]string, error) {
+	path := filepath.Join(dir, file)
+	if _, e := os.Stat(path); os.IsNotExist(e) {
+		return fallback, nil
+	}
+	var names []string
+	e := readFile(path, func(r io.Reader) error {
+		raw, e := ioutil.ReadAll(r)
+		for _, line := range strings.Split(string(raw), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				names = append(names, line)
+			}
+		}
+		return e
+	})
+	if e == nil && len(names) != len(fallback) {
+		e = fmt.Errorf("%s has %d label names, not %d", path, len(names), len(fallback))
+	}
+	return names, e
+}
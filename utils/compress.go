@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// gzipMagic starts every gzip stream
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// decompress gives the contents of r, gunzipping them if they're gzipped
+func decompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(gzipMagic))
+	if err != nil || magic[0] != gzipMagic[0] || magic[1] != gzipMagic[1] {
+		// too short to be gzip, so whatever reads it will find out it's too short
+		return br, nil
+	}
+	zr, err := gzip.NewReader(br)
+	if err != nil {
+		return nil, fmt.Errorf("gzip: %v", err)
+	}
+	return zr, nil
+}
+
+// findFile is the path to name in dir, or to its gzipped copy name.gz if only
+// that exists
+func findFile(dir, name string) string {
+	path := filepath.Join(dir, name)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if _, err := os.Stat(path + ".gz"); err == nil {
+			return path + ".gz"
+		}
+	}
+	return path
+}
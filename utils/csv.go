@@ -0,0 +1,564 @@
+package utils
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Encoding is how categorical input columns are turned into numbers
+type Encoding int
+
+const (
+	// OneHot gives each category its own input, 1 for the row's category and 0 for the rest
+	OneHot Encoding = iota
+	// Ordinal gives the column one input, the index of the row's category
+	Ordinal
+)
+
+// MissingStrategy is what's done with missing values in input columns. Rows
+// missing their target are always left out
+type MissingStrategy int
+
+const (
+	// MissingMean fills numeric columns with their mean and categorical ones
+	// with their most frequent category
+	MissingMean MissingStrategy = iota
+	// MissingMedian fills numeric columns with their median and categorical
+	// ones with their most frequent category
+	MissingMedian
+	// MissingMostFrequent fills every column with its most frequent value
+	MissingMostFrequent
+	// MissingZero encodes missing values as zeros: 0 for numeric columns, no
+	// category at all for one-hot ones and the first category for ordinal ones
+	MissingZero
+	// MissingDrop leaves out rows with any value missing
+	MissingDrop
+	// MissingError fails on the first missing value
+	MissingError
+)
+
+// defaultMissingValues are the values counted as missing if CSVConfig doesn't say
+var defaultMissingValues = []string{"", "NA", "N/A", "NaN", "nan", "null", "NULL", "?"}
+
+// CSVConfig is the configuration for reading a table from a CSV file
+type CSVConfig struct {
+	// Comma separates the fields, ',' by default. LoadCSV defaults to '\t'
+	// for .tsv and .tab files
+	Comma rune
+
+	// NoHeader is set if the first row is data rather than column names. The
+	// columns are then named by their index, "0", "1" and so on
+	NoHeader bool
+
+	// Target is the column to predict, the last one if not set. If it's
+	// categorical the targets are one-hot over its categories, otherwise
+	// they're its value
+	Target string
+
+	// Categorical columns are treated as categories even if every value is a
+	// number, like integer class labels. Any column with a value that isn't
+	// a number is categorical anyway
+	Categorical []string
+
+	// Ignore columns are left out of the inputs, like IDs
+	Ignore []string
+
+	// Encoding of categorical input columns
+	Encoding Encoding
+
+	// Missing is what's done with missing values, and MissingValues are the
+	// values (after trimming spaces) counted as missing. By default those are
+	// "", "NA", "N/A", "NaN", "nan", "null", "NULL" and "?"
+	Missing       MissingStrategy
+	MissingValues []string
+
+	// UnseenAsMissing handles a category the encoder wasn't fitted with, in
+	// rows encoded later, as missing (unless Missing is MissingError).
+	// Otherwise it's an error
+	UnseenAsMissing bool
+
+	// Standardize scales numeric inputs to a mean of 0 and standard deviation of 1
+	Standardize bool
+}
+
+// TableColumn is what a TableEncoder learned about one column
+type TableColumn struct {
+	Name        string
+	Categorical bool
+	Ignored     bool
+
+	// Categories of a categorical column, sorted
+	Categories []string
+
+	// statistics of a numeric column's values, for filling in missing ones
+	// and standardizing. Like the categories, they're only of the rows that
+	// were encoded, not those left out for missing values
+	Mean   float64
+	Median float64
+	Std    float64
+
+	// MostFrequent is the column's most common value, for filling in missing ones
+	MostFrequent string
+}
+
+// TableEncoder turns rows of a table into inputs and targets, the same way
+// every time, once it has been fitted to the table it was read with. It has
+// only exported fields, so it can be saved (with encoding/json say) and used
+// to encode rows at prediction time
+type TableEncoder struct {
+	Columns []TableColumn
+	Target  int
+
+	Comma           rune
+	NoHeader        bool
+	Encoding        Encoding
+	Missing         MissingStrategy
+	MissingValues   []string
+	UnseenAsMissing bool
+	Standardize     bool
+}
+
+// LoadCSV reads the table in the file at path, which may be gzipped, as ReadCSV does
+func LoadCSV(path string, config CSVConfig) (*SliceDataset, *TableEncoder, error) {
+	if config.Comma == 0 {
+		switch filepath.Ext(strings.TrimSuffix(path, ".gz")) {
+		case ".tsv", ".tab":
+			config.Comma = '\t'
+		}
+	}
+	var data *SliceDataset
+	var te *TableEncoder
+	e := readFile(path, func(r io.Reader) (e error) {
+		data, te, e = ReadCSV(r, config)
+		return e
+	})
+	return data, te, e
+}
+
+// ReadCSV reads a table from r, infers which columns are numeric and which
+// categorical, and fits a TableEncoder to it. It returns the table encoded as
+// a Dataset, along with the encoder to encode more rows the same way
+func ReadCSV(r io.Reader, config CSVConfig) (*SliceDataset, *TableEncoder, error) {
+	te := &TableEncoder{
+		Comma:           config.Comma,
+		NoHeader:        config.NoHeader,
+		Encoding:        config.Encoding,
+		Missing:         config.Missing,
+		MissingValues:   config.MissingValues,
+		UnseenAsMissing: config.UnseenAsMissing,
+		Standardize:     config.Standardize,
+	}
+	if te.Comma == 0 {
+		te.Comma = ','
+	}
+	if te.MissingValues == nil {
+		te.MissingValues = defaultMissingValues
+	}
+
+	header, rows, e := te.readRecords(r)
+	if e != nil {
+		return nil, nil, e
+	}
+	if e := te.fit(header, rows, config); e != nil {
+		return nil, nil, e
+	}
+	data, e := te.encodeRows(rows)
+	if e != nil {
+		return nil, nil, e
+	}
+	return data, te, nil
+}
+
+// ReadCSV reads more of the table the encoder was fitted to, like a test set,
+// and encodes it the same way. It needs the same columns, target included
+func (te *TableEncoder) ReadCSV(r io.Reader) (*SliceDataset, error) {
+	header, rows, e := te.readRecords(r)
+	if e != nil {
+		return nil, e
+	}
+	if len(header) != len(te.Columns) {
+		return nil, fmt.Errorf("table has %d columns, not %d", len(header), len(te.Columns))
+	}
+	for c, name := range header {
+		if name != te.Columns[c].Name {
+			return nil, fmt.Errorf("column %d is %q, not %q", c, name, te.Columns[c].Name)
+		}
+	}
+	return te.encodeRows(rows)
+}
+
+// InputSize is how many values each encoded input has
+func (te *TableEncoder) InputSize() int {
+	size := 0
+	for c, col := range te.Columns {
+		if c == te.Target || col.Ignored {
+			continue
+		}
+		size += te.width(col)
+	}
+	return size
+}
+
+// TargetSize is how many values each encoded target has
+func (te *TableEncoder) TargetSize() int {
+	col := te.Columns[te.Target]
+	if col.Categorical {
+		return len(col.Categories)
+	}
+	return 1
+}
+
+// EncodeInput encodes a row to predict from. It can either have every column,
+// the target's value being ignored, or every column but the target
+func (te *TableEncoder) EncodeInput(record []string) ([]float64, error) {
+	if len(record) == len(te.Columns)-1 {
+		record = append(append(append([]string{}, record[:te.Target]...), ""), record[te.Target:]...)
+	}
+	if len(record) != len(te.Columns) {
+		return nil, fmt.Errorf("row has %d values, not %d", len(record), len(te.Columns))
+	}
+	input, ok, e := te.encodeInput(record)
+	if e != nil {
+		return nil, e
+	}
+	if !ok {
+		return nil, fmt.Errorf("row is missing values")
+	}
+	return input, nil
+}
+
+// DecodeTarget is the target value an output stands for: the most likely
+// category of a categorical target, or the value of a numeric one
+func (te *TableEncoder) DecodeTarget(output []float64) string {
+	col := te.Columns[te.Target]
+	if !col.Categorical {
+		return strconv.FormatFloat(output[0], 'g', -1, 64)
+	}
+	best := 0
+	for i := range output {
+		if output[i] > output[best] {
+			best = i
+		}
+	}
+	return col.Categories[best]
+}
+
+// readRecords reads the header (made up if there isn't one) and the rows of a
+// table, with the spaces around each value trimmed
+func (te *TableEncoder) readRecords(r io.Reader) ([]string, [][]string, error) {
+	r, e := decompress(r)
+	if e != nil {
+		return nil, nil, e
+	}
+	cr := csv.NewReader(r)
+	cr.Comma = te.Comma
+	cr.TrimLeadingSpace = true
+	rows, e := cr.ReadAll()
+	if e != nil {
+		return nil, nil, e
+	}
+	for _, row := range rows {
+		for i := range row {
+			row[i] = strings.TrimSpace(row[i])
+		}
+	}
+
+	var header []string
+	if te.NoHeader {
+		if len(rows) > 0 {
+			for c := range rows[0] {
+				header = append(header, strconv.Itoa(c))
+			}
+		}
+	} else if len(rows) > 0 {
+		header, rows = rows[0], rows[1:]
+	}
+	if len(header) == 0 {
+		return nil, nil, fmt.Errorf("table has no columns")
+	}
+	return header, rows, nil
+}
+
+// fit learns the columns of the table from its rows
+func (te *TableEncoder) fit(header []string, rows [][]string, config CSVConfig) error {
+	index := make(map[string]int, len(header))
+	for c, name := range header {
+		if _, ok := index[name]; ok {
+			return fmt.Errorf("column %q appears twice", name)
+		}
+		index[name] = c
+	}
+	lookup := func(name string) (int, error) {
+		c, ok := index[name]
+		if !ok {
+			return 0, fmt.Errorf("no column %q", name)
+		}
+		return c, nil
+	}
+
+	te.Columns = make([]TableColumn, len(header))
+	for c, name := range header {
+		te.Columns[c].Name = name
+	}
+	te.Target = len(header) - 1
+	if config.Target != "" {
+		c, e := lookup(config.Target)
+		if e != nil {
+			return e
+		}
+		te.Target = c
+	}
+	for _, name := range config.Categorical {
+		c, e := lookup(name)
+		if e != nil {
+			return e
+		}
+		te.Columns[c].Categorical = true
+	}
+	for _, name := range config.Ignore {
+		c, e := lookup(name)
+		if e != nil {
+			return e
+		}
+		if c == te.Target {
+			return fmt.Errorf("can't ignore the target column %q", name)
+		}
+		te.Columns[c].Ignored = true
+	}
+
+	// the columns are only fitted to the rows that will be encoded
+	var kept [][]string
+	for _, row := range rows {
+		if !te.dropped(row) {
+			kept = append(kept, row)
+		}
+	}
+	for c := range te.Columns {
+		col := &te.Columns[c]
+		var values []string
+		for _, row := range kept {
+			if !te.isMissing(row[c]) {
+				values = append(values, row[c])
+			}
+		}
+		if !col.Categorical {
+			for _, v := range values {
+				if _, e := strconv.ParseFloat(v, 64); e != nil {
+					col.Categorical = true
+					break
+				}
+			}
+		}
+		fitColumn(col, values)
+	}
+	if col := te.Columns[te.Target]; col.Categorical && len(col.Categories) == 0 {
+		return fmt.Errorf("target column %q has no values", col.Name)
+	}
+	return nil
+}
+
+// fitColumn learns the categories or statistics of a column from its values
+func fitColumn(col *TableColumn, values []string) {
+	counts := make(map[string]int)
+	for _, v := range values {
+		counts[v]++
+	}
+	col.Categories = col.Categories[:0]
+	for v, n := range counts {
+		col.Categories = append(col.Categories, v)
+		if n > counts[col.MostFrequent] || (n == counts[col.MostFrequent] && v < col.MostFrequent) {
+			col.MostFrequent = v
+		}
+	}
+	sort.Strings(col.Categories)
+	if col.Categorical {
+		return
+	}
+	col.Categories = nil
+
+	nums := make([]float64, len(values))
+	for i, v := range values {
+		nums[i], _ = strconv.ParseFloat(v, 64)
+	}
+	col.Std = 1
+	if len(nums) == 0 {
+		return
+	}
+	sort.Float64s(nums)
+	col.Median = nums[len(nums)/2]
+	if len(nums)%2 == 0 {
+		col.Median = (nums[len(nums)/2-1] + nums[len(nums)/2]) / 2
+	}
+	for _, x := range nums {
+		col.Mean += x
+	}
+	col.Mean /= float64(len(nums))
+	variance := 0.0
+	for _, x := range nums {
+		variance += (x - col.Mean) * (x - col.Mean)
+	}
+	if std := math.Sqrt(variance / float64(len(nums))); std > 0 {
+		col.Std = std
+	}
+}
+
+// dropped reports whether row is left out of the table for missing its target,
+// or with MissingDrop any input
+func (te *TableEncoder) dropped(row []string) bool {
+	if te.isMissing(row[te.Target]) {
+		return true
+	}
+	if te.Missing != MissingDrop {
+		return false
+	}
+	for c, col := range te.Columns {
+		if c != te.Target && !col.Ignored && te.isMissing(row[c]) {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeRows encodes a table's rows, leaving out those missing their target
+// (or any value, with MissingDrop)
+func (te *TableEncoder) encodeRows(rows [][]string) (*SliceDataset, error) {
+	var inputs, targets [][]float64
+	for i, row := range rows {
+		// rows are numbered as lines of the file
+		line := i + 1
+		if !te.NoHeader {
+			line++
+		}
+		target, ok, e := te.encodeTarget(row[te.Target])
+		if e != nil {
+			return nil, fmt.Errorf("line %d: %v", line, e)
+		}
+		if !ok {
+			continue
+		}
+		input, ok, e := te.encodeInput(row)
+		if e != nil {
+			return nil, fmt.Errorf("line %d: %v", line, e)
+		}
+		if !ok {
+			continue
+		}
+		inputs = append(inputs, input)
+		targets = append(targets, target)
+	}
+	return NewSliceDataset(inputs, targets)
+}
+
+// encodeTarget encodes a target value, reporting false if it's missing
+func (te *TableEncoder) encodeTarget(value string) ([]float64, bool, error) {
+	if te.isMissing(value) {
+		return nil, false, nil
+	}
+	col := te.Columns[te.Target]
+	if !col.Categorical {
+		x, e := strconv.ParseFloat(value, 64)
+		if e != nil {
+			return nil, false, fmt.Errorf("target %q isn't a number", value)
+		}
+		return []float64{x}, true, nil
+	}
+	k := sort.SearchStrings(col.Categories, value)
+	if k == len(col.Categories) || col.Categories[k] != value {
+		return nil, false, fmt.Errorf("target %q isn't one of the %d categories", value, len(col.Categories))
+	}
+	target := make([]float64, len(col.Categories))
+	target[k] = 1
+	return target, true, nil
+}
+
+// encodeInput encodes the input columns of a row, reporting false if the row
+// should be dropped for missing a value
+func (te *TableEncoder) encodeInput(row []string) ([]float64, bool, error) {
+	input := make([]float64, 0, te.InputSize())
+	for c, col := range te.Columns {
+		if c == te.Target || col.Ignored {
+			continue
+		}
+		value := row[c]
+		missing := te.isMissing(value)
+		if col.Categorical && !missing {
+			k := sort.SearchStrings(col.Categories, value)
+			if k == len(col.Categories) || col.Categories[k] != value {
+				if !te.UnseenAsMissing || te.Missing == MissingError {
+					return nil, false, fmt.Errorf("unseen category %q in column %q", value, col.Name)
+				}
+				missing = true
+			}
+		}
+		if missing {
+			switch te.Missing {
+			case MissingDrop:
+				return nil, false, nil
+			case MissingError:
+				return nil, false, fmt.Errorf("column %q is missing", col.Name)
+			case MissingZero:
+				input = append(input, make([]float64, te.width(col))...)
+				continue
+			}
+			value = te.fill(col)
+		}
+
+		if !col.Categorical {
+			x, e := strconv.ParseFloat(value, 64)
+			if e != nil {
+				return nil, false, fmt.Errorf("column %q value %q isn't a number", col.Name, value)
+			}
+			if te.Standardize {
+				x = (x - col.Mean) / col.Std
+			}
+			input = append(input, x)
+			continue
+		}
+		k := sort.SearchStrings(col.Categories, value)
+		if te.Encoding == Ordinal {
+			input = append(input, float64(k))
+			continue
+		}
+		onehot := make([]float64, len(col.Categories))
+		if k < len(onehot) {
+			onehot[k] = 1
+		}
+		input = append(input, onehot...)
+	}
+	return input, true, nil
+}
+
+// fill is the value a missing one in col is replaced with
+func (te *TableEncoder) fill(col TableColumn) string {
+	if col.Categorical || (te.Missing == MissingMostFrequent && col.MostFrequent != "") {
+		return col.MostFrequent
+	}
+	if te.Missing == MissingMedian {
+		return strconv.FormatFloat(col.Median, 'g', -1, 64)
+	}
+	return strconv.FormatFloat(col.Mean, 'g', -1, 64)
+}
+
+// width is how many inputs col is encoded as
+func (te *TableEncoder) width(col TableColumn) int {
+	if col.Categorical && te.Encoding == OneHot {
+		return len(col.Categories)
+	}
+	return 1
+}
+
+// isMissing reports whether value counts as missing
+func (te *TableEncoder) isMissing(value string) bool {
+	for _, m := range te.MissingValues {
+		if value == m {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,231 @@
+package utils
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+)
+
+// the row with id 4 is missing its label, so its green and its size of 100
+// shouldn't be fitted
+const csvTable = `id,color,size,price,label
+1,red,1,10,yes
+2,blue,2,NA,no
+3,red,NA,30,yes
+4,green,100,20,
+5,blue,6,40,no
+`
+
+func readTable(t *testing.T, config CSVConfig) (*SliceDataset, *TableEncoder) {
+	t.Helper()
+	data, te, err := ReadCSV(strings.NewReader(csvTable), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data, te
+}
+
+func approxEqual(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if math.Abs(a[i]-b[i]) > 1e-12 {
+			return false
+		}
+	}
+	return true
+}
+
+// checkInputs compares every encoded input of data with want
+func checkInputs(t *testing.T, name string, data *SliceDataset, want [][]float64) {
+	t.Helper()
+	if data.Len() != len(want) {
+		t.Fatalf("%s: %d rows, want %d", name, data.Len(), len(want))
+	}
+	for i := range want {
+		if input, _ := data.Get(i); !approxEqual(input, want[i]) {
+			t.Errorf("%s: row %d is %v, want %v", name, i, input, want[i])
+		}
+	}
+}
+
+func TestCSVColumnTypes(t *testing.T) {
+	_, te := readTable(t, CSVConfig{})
+	// missing values don't make a numeric column categorical
+	want := map[string]bool{"id": false, "color": true, "size": false, "price": false, "label": true}
+	for _, col := range te.Columns {
+		if col.Categorical != want[col.Name] {
+			t.Errorf("column %q categorical is %v, want %v", col.Name, col.Categorical, want[col.Name])
+		}
+	}
+	if te.Target != 4 {
+		t.Errorf("target is column %d, want the last", te.Target)
+	}
+
+	// with color as the target, the row missing its label is kept
+	_, te = readTable(t, CSVConfig{Categorical: []string{"id"}, Target: "color"})
+	if id := te.Columns[0]; !id.Categorical || strings.Join(id.Categories, " ") != "1 2 3 4 5" {
+		t.Errorf("id column is categorical %v with categories %v, want 1 2 3 4 5", id.Categorical, id.Categories)
+	}
+	if te.Target != 1 || te.TargetSize() != 3 {
+		t.Errorf("target is column %d of %d categories, want color's 3", te.Target, te.TargetSize())
+	}
+}
+
+func TestCSVFitsKeptRows(t *testing.T) {
+	_, te := readTable(t, CSVConfig{})
+	if color := te.Columns[1]; strings.Join(color.Categories, " ") != "blue red" {
+		t.Errorf("color categories are %v, want blue red", color.Categories)
+	}
+	if size := te.Columns[2]; size.Mean != 3 || size.Median != 2 {
+		t.Errorf("size mean and median are %v and %v, want 3 and 2", size.Mean, size.Median)
+	}
+
+	// dropping rows for any missing value leaves only rows 1 and 5 to fit
+	_, te = readTable(t, CSVConfig{Missing: MissingDrop})
+	if size := te.Columns[2]; size.Mean != 3.5 {
+		t.Errorf("size mean is %v with MissingDrop, want 3.5", size.Mean)
+	}
+}
+
+func TestCSVEncoding(t *testing.T) {
+	data, te := readTable(t, CSVConfig{Ignore: []string{"id"}})
+	checkInputs(t, "one-hot", data, [][]float64{
+		{0, 1, 1, 10},
+		{1, 0, 2, 80. / 3},
+		{0, 1, 3, 30},
+		{1, 0, 6, 40},
+	})
+	if te.InputSize() != 4 || te.TargetSize() != 2 {
+		t.Errorf("inputs and targets have %d and %d values, want 4 and 2", te.InputSize(), te.TargetSize())
+	}
+	for i, want := range [][]float64{{0, 1}, {1, 0}, {0, 1}, {1, 0}} {
+		if _, target := data.Get(i); !approxEqual(target, want) {
+			t.Errorf("target %d is %v, want %v", i, target, want)
+		}
+	}
+
+	data, _ = readTable(t, CSVConfig{Ignore: []string{"id"}, Encoding: Ordinal})
+	checkInputs(t, "ordinal", data, [][]float64{
+		{1, 1, 10},
+		{0, 2, 80. / 3},
+		{1, 3, 30},
+		{0, 6, 40},
+	})
+
+	data, _ = readTable(t, CSVConfig{Ignore: []string{"id"}, Standardize: true})
+	std := math.Sqrt(14. / 3)
+	if input, _ := data.Get(0); math.Abs(input[2]-(1-3)/std) > 1e-12 {
+		t.Errorf("standardized size is %v, want %v", input[2], (1-3)/std)
+	}
+
+	// a numeric target is its value
+	data, te = readTable(t, CSVConfig{Target: "size", Ignore: []string{"id"}})
+	if _, target := data.Get(0); !approxEqual(target, []float64{1}) || te.TargetSize() != 1 {
+		t.Errorf("numeric target is %v, want [1]", target)
+	}
+}
+
+func TestCSVMissing(t *testing.T) {
+	tests := []struct {
+		name    string
+		missing MissingStrategy
+		want    [][]float64
+	}{
+		// rows 2 and 3 are missing price and size
+		{"mean", MissingMean, [][]float64{{0, 1, 1, 10}, {1, 0, 2, 80. / 3}, {0, 1, 3, 30}, {1, 0, 6, 40}}},
+		{"median", MissingMedian, [][]float64{{0, 1, 1, 10}, {1, 0, 2, 30}, {0, 1, 2, 30}, {1, 0, 6, 40}}},
+		// every value is as frequent, so the first wins
+		{"most frequent", MissingMostFrequent, [][]float64{{0, 1, 1, 10}, {1, 0, 2, 10}, {0, 1, 1, 30}, {1, 0, 6, 40}}},
+		{"zero", MissingZero, [][]float64{{0, 1, 1, 10}, {1, 0, 2, 0}, {0, 1, 0, 30}, {1, 0, 6, 40}}},
+		{"drop", MissingDrop, [][]float64{{0, 1, 1, 10}, {1, 0, 6, 40}}},
+	}
+	for _, test := range tests {
+		data, _ := readTable(t, CSVConfig{Ignore: []string{"id"}, Missing: test.missing})
+		checkInputs(t, test.name, data, test.want)
+	}
+
+	_, _, err := ReadCSV(strings.NewReader(csvTable), CSVConfig{Missing: MissingError})
+	if err == nil || !strings.Contains(err.Error(), `line 3: column "price" is missing`) {
+		t.Errorf("MissingError gave %v", err)
+	}
+
+	// a missing categorical value takes the most frequent category, blue
+	// winning the tie with red
+	data, _, err := ReadCSV(strings.NewReader("color,label\nred,a\nNA,b\nblue,a\n"), CSVConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkInputs(t, "missing category", data, [][]float64{{0, 1}, {1, 0}, {1, 0}})
+}
+
+func TestCSVReuseEncoder(t *testing.T) {
+	_, fitted := readTable(t, CSVConfig{Ignore: []string{"id"}})
+
+	// the encoder works the same once saved and loaded
+	saved, err := json.Marshal(fitted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	te := &TableEncoder{}
+	if err := json.Unmarshal(saved, te); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := te.ReadCSV(strings.NewReader("id,color,size,price,label\n6,blue,4,NA,yes\n7,red,5,50,\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// fitted statistics fill in the new rows, and the unlabelled row is left out
+	checkInputs(t, "test set", data, [][]float64{{1, 0, 4, 80. / 3}})
+
+	if _, err := te.ReadCSV(strings.NewReader("id,colour,size,price,label\n")); err == nil {
+		t.Errorf("read a table with a renamed column")
+	}
+
+	// rows to predict from can leave out the target
+	for _, record := range [][]string{{"8", "red", "2", "20"}, {"8", "red", "2", "20", "?"}} {
+		input, err := te.EncodeInput(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !approxEqual(input, []float64{0, 1, 2, 20}) {
+			t.Errorf("encoded %v as %v", record, input)
+		}
+	}
+	if label := te.DecodeTarget([]float64{.2, .8}); label != "yes" {
+		t.Errorf("decoded the target as %q, want yes", label)
+	}
+}
+
+func TestCSVUnseenCategory(t *testing.T) {
+	green := []string{"8", "green", "2", "20"}
+
+	_, te := readTable(t, CSVConfig{Ignore: []string{"id"}})
+	if _, err := te.EncodeInput(green); err == nil || err.Error() != `unseen category "green" in column "color"` {
+		t.Errorf("encoding an unseen category gave %v", err)
+	}
+
+	_, te = readTable(t, CSVConfig{Ignore: []string{"id"}, UnseenAsMissing: true})
+	input, err := te.EncodeInput(green)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !approxEqual(input, []float64{1, 0, 2, 20}) {
+		t.Errorf("unseen category filled in as %v, want blue", input)
+	}
+
+	_, te = readTable(t, CSVConfig{Ignore: []string{"id"}, UnseenAsMissing: true, Missing: MissingZero})
+	if input, _ := te.EncodeInput(green); !approxEqual(input, []float64{0, 0, 2, 20}) {
+		t.Errorf("unseen category zeroed as %v", input)
+	}
+
+	// it's still unseen rather than missing when missing values are errors
+	_, te = readTable(t, CSVConfig{Ignore: []string{"id"}, UnseenAsMissing: true, Missing: MissingMostFrequent})
+	te.Missing = MissingError
+	if _, err := te.EncodeInput(green); err == nil || !strings.Contains(err.Error(), "unseen category") {
+		t.Errorf("encoding an unseen category with MissingError gave %v", err)
+	}
+}
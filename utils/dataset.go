@@ -0,0 +1,80 @@
+package utils
+
+import "fmt"
+
+// Dataset is a collection of samples that can be read in any order, each an
+// input vector and the target a network should output for it. A DataLoader
+// may call Get from several goroutines at once
+type Dataset interface {
+	Len() int
+	Get(i int) (input, target []float64)
+}
+
+// SliceDataset is a Dataset of inputs and targets already in memory
+type SliceDataset struct {
+	inputs  [][]float64
+	targets [][]float64
+}
+
+// NewSliceDataset pairs each input with the target at the same index
+func NewSliceDataset(inputs, targets [][]float64) (*SliceDataset, error) {
+	if len(inputs) != len(targets) {
+		return nil, fmt.Errorf("%d inputs but %d targets", len(inputs), len(targets))
+	}
+	return &SliceDataset{inputs: inputs, targets: targets}, nil
+}
+
+func (sd *SliceDataset) Len() int {
+	return len(sd.inputs)
+}
+
+func (sd *SliceDataset) Get(i int) ([]float64, []float64) {
+	return sd.inputs[i], sd.targets[i]
+}
+
+// digitClasses is how many labels a DataSet's targets are one-hot over when
+// it has no LabelNames
+const digitClasses = 10
+
+// Len makes a DataSet a Dataset
+func (ds *DataSet) Len() int {
+	return len(ds.Data)
+}
+
+// Get is the i'th image as pixels scaled to [0, 1], channel by channel and row
+// by row (the layout of a zdnn.Shape), with its label one-hot encoded as the
+// target
+func (ds *DataSet) Get(i int) ([]float64, []float64) {
+	return digitSample(ds.Data[i], ds.W*ds.H*ds.Channels, ds.classes())
+}
+
+// classes is how many labels there are
+func (ds *DataSet) classes() int {
+	if len(ds.LabelNames) > 0 {
+		return len(ds.LabelNames)
+	}
+	return digitClasses
+}
+
+// checkLabel errors unless the i'th image's label is one of classes, which
+// would have its one-hot target out of range
+func checkLabel(i, label, classes int) error {
+	if label < 0 || label >= classes {
+		return fmt.Errorf("image %d has label %d of %d", i, label, classes)
+	}
+	return nil
+}
+
+// digitSample encodes an image of size pixels with a label out of classes the
+// way DataSet.Get does
+func digitSample(data DigitImage, size, classes int) ([]float64, []float64) {
+	input := make([]float64, 0, size)
+	for _, row := range data.Image {
+		for _, pix := range row {
+			input = append(input, float64(pix)/255)
+		}
+	}
+	target := make([]float64, classes)
+	target[data.Digit] = 1
+	return input, target
+}
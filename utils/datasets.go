@@ -0,0 +1,134 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// labels of the Fashion-MNIST and KMNIST classes
+var (
+	fashionNames = []string{"T-shirt/top", "Trouser", "Pullover", "Dress", "Coat", "Sandal", "Shirt", "Sneaker", "Bag", "Ankle boot"}
+	kmnistNames  = []string{"お", "き", "す", "つ", "な", "は", "ま", "や", "れ", "を"}
+)
+
+// ReadFashionMNIST reads the Fashion-MNIST training or test set from dir,
+// which holds the files under the same names as MNIST's
+func ReadFashionMNIST(dir string, train bool) (*DataSet, error) {
+	return readMNISTSet(dir, train, fashionNames)
+}
+
+// ReadKMNIST reads the Kuzushiji-MNIST training or test set from dir, which
+// holds the files under the same names as MNIST's
+func ReadKMNIST(dir string, train bool) (*DataSet, error) {
+	return readMNISTSet(dir, train, kmnistNames)
+}
+
+// EMNIST splits
+const (
+	EMNISTByClass  = "byclass"
+	EMNISTByMerge  = "bymerge"
+	EMNISTBalanced = "balanced"
+	EMNISTLetters  = "letters"
+	EMNISTDigits   = "digits"
+	EMNISTMNIST    = "mnist"
+)
+
+// emnistNames are the labels of each EMNIST split. The merged splits keep
+// only the lowercase letters that look different from their capitals, and
+// letters has each letter's cases as one label
+func emnistNames(split string) ([]string, error) {
+	upper := strings.Split("ABCDEFGHIJKLMNOPQRSTUVWXYZ", "")
+	switch split {
+	case EMNISTByClass:
+		return concat(digitNames, upper, strings.Split("abcdefghijklmnopqrstuvwxyz", "")), nil
+	case EMNISTByMerge, EMNISTBalanced:
+		return concat(digitNames, upper, strings.Split("abdefghnqrt", "")), nil
+	case EMNISTLetters:
+		return upper, nil
+	case EMNISTDigits, EMNISTMNIST:
+		return digitNames, nil
+	}
+	return nil, fmt.Errorf("unknown EMNIST split %q", split)
+}
+
+// emnistFiles are the paths to a split's training or test images and labels in dir
+func emnistFiles(dir, split string, train bool) (string, string) {
+	set := "test"
+	if train {
+		set = "train"
+	}
+	prefix := "emnist-" + split + "-" + set + "-"
+	return findFile(dir, prefix+"images-idx3-ubyte"), findFile(dir, prefix+"labels-idx1-ubyte")
+}
+
+// emnistLabelOffset is what EMNIST's labels for split start at. Only letters
+// doesn't start at 0, which the readers shift it to
+func emnistLabelOffset(split string) int {
+	if split == EMNISTLetters {
+		return 1
+	}
+	return 0
+}
+
+// ReadEMNIST reads the training or test set of one of the EMNIST splits from
+// dir, which holds the files as named in the EMNIST distribution, like
+// emnist-balanced-train-images-idx3-ubyte. The images are turned upright, and
+// the letters split's labels start at 0 like the others
+func ReadEMNIST(dir, split string, train bool) (*DataSet, error) {
+	labelNames, e := emnistNames(split)
+	if e != nil {
+		return nil, e
+	}
+	imagesPath, labelsPath := emnistFiles(dir, split, train)
+	dataSet, e := readDataSet(imagesPath, labelsPath, labelNames, emnistLabelOffset(split))
+	if e != nil {
+		return nil, e
+	}
+	for i := range dataSet.Data {
+		data := &dataSet.Data[i]
+		data.Image = transposed(data.Image)
+	}
+	dataSet.W, dataSet.H = dataSet.H, dataSet.W
+	return dataSet, nil
+}
+
+// OpenEMNIST is ReadEMNIST one image at a time, for the bigger splits
+func OpenEMNIST(dir, split string, train bool) (*DigitReader, error) {
+	labelNames, e := emnistNames(split)
+	if e != nil {
+		return nil, e
+	}
+	dr, e := OpenDigitReader(emnistFiles(dir, split, train))
+	if e != nil {
+		return nil, e
+	}
+	dr.W, dr.H = dr.H, dr.W
+	dr.LabelNames = labelNames
+	dr.transpose = true
+	dr.labelOffset = emnistLabelOffset(split)
+	return dr, nil
+}
+
+// internal: image with its rows and columns swapped
+func transposed(image [][]uint8) [][]uint8 {
+	if len(image) == 0 {
+		return image
+	}
+	h, w := len(image), len(image[0])
+	pixels := make([]uint8, h*w)
+	for r, row := range image {
+		for c, pix := range row {
+			pixels[c*h+r] = pix
+		}
+	}
+	return splitToRows(pixels, w, h)
+}
+
+// internal: the lists one after another
+func concat(lists ...[]string) []string {
+	var all []string
+	for _, l := range lists {
+		all = append(all, l...)
+	}
+	return all
+}
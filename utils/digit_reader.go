@@ -0,0 +1,189 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// DigitReader reads MNIST style images and their labels one at a time, for
+// data sets too big to read into memory at once:
+//
+//	dr, err := OpenDigitReader(imagesPath, labelsPath)
+//	...
+//	defer dr.Close()
+//	for dr.Next() {
+//		img := dr.Image()
+//		...
+//	}
+//	if err := dr.Err(); err != nil {
+//		...
+//	}
+type DigitReader struct {
+	// number of images and their size, from the files' headers
+	N int
+	W int
+	H int
+
+	// LabelNames, if set, are what the labels mean, and how many there are.
+	// Otherwise the labels are digits, 0 to 9. Next stops with an error at
+	// any label out of range
+	LabelNames []string
+
+	images io.Reader
+	labels io.Reader
+	files  []*os.File
+
+	// transpose images stored column by column, and take labelOffset from
+	// labels that don't start at 0, like EMNIST's
+	transpose   bool
+	labelOffset int
+
+	read  int
+	image DigitImage
+	err   error
+}
+
+// NewDigitReader reads images and labels in the MNIST IDX format, either of
+// which may be gzipped. Only the headers are read until Next is called
+func NewDigitReader(imagesReader, labelsReader io.Reader) (*DigitReader, error) {
+	images, e := decompress(imagesReader)
+	if e != nil {
+		return nil, e
+	}
+	t, imageDims, e := readIDXHeader(images)
+	if e != nil {
+		return nil, e
+	}
+	if e := checkImages(t, imageDims); e != nil {
+		return nil, e
+	}
+
+	labels, e := decompress(labelsReader)
+	if e != nil {
+		return nil, e
+	}
+	t, labelDims, e := readIDXHeader(labels)
+	if e != nil {
+		return nil, e
+	}
+	if e := checkLabels(t, labelDims); e != nil {
+		return nil, e
+	}
+
+	if labelDims[0] != imageDims[0] {
+		return nil, fmt.Errorf("%d labels but %d images", labelDims[0], imageDims[0])
+	}
+	// dimensions are images, rows, columns
+	return &DigitReader{N: imageDims[0], W: imageDims[2], H: imageDims[1], images: images, labels: labels}, nil
+}
+
+// OpenDigitReader opens the images and labels files at the paths, either of
+// which may be gzipped, to read them one image at a time. Close closes them
+func OpenDigitReader(imagesPath, labelsPath string) (*DigitReader, error) {
+	images, e := os.Open(imagesPath)
+	if e != nil {
+		return nil, e
+	}
+	labels, e := os.Open(labelsPath)
+	if e != nil {
+		images.Close()
+		return nil, e
+	}
+	dr, e := NewDigitReader(images, labels)
+	if e != nil {
+		images.Close()
+		labels.Close()
+		return nil, fmt.Errorf("%s, %s: %v", imagesPath, labelsPath, e)
+	}
+	dr.files = []*os.File{images, labels}
+	return dr, nil
+}
+
+// Next reads the next image, reporting false once they've all been read or
+// reading one fails (see Err)
+func (dr *DigitReader) Next() bool {
+	if dr.err != nil || dr.read >= dr.N {
+		return false
+	}
+	var label [1]byte
+	if _, e := io.ReadFull(dr.labels, label[:]); e != nil {
+		dr.err = fmt.Errorf("reading label %d: %v", dr.read, unexpectedEOF(e))
+		return false
+	}
+	pixels := make([]uint8, dr.W*dr.H)
+	if _, e := io.ReadFull(dr.images, pixels); e != nil {
+		dr.err = fmt.Errorf("reading image %d: %v", dr.read, unexpectedEOF(e))
+		return false
+	}
+	image := splitToRows(pixels, dr.H, dr.W)
+	if dr.transpose {
+		image = transposed(splitToRows(pixels, dr.W, dr.H))
+	}
+	digit := int(label[0]) - dr.labelOffset
+	if e := checkLabel(dr.read, digit, dr.classes()); e != nil {
+		dr.err = e
+		return false
+	}
+	dr.image = DigitImage{Digit: digit, Image: image}
+	dr.read++
+	return true
+}
+
+// classes is how many labels there are
+func (dr *DigitReader) classes() int {
+	if len(dr.LabelNames) > 0 {
+		return len(dr.LabelNames)
+	}
+	return digitClasses
+}
+
+// Image is the image the last call to Next read
+func (dr *DigitReader) Image() DigitImage {
+	return dr.image
+}
+
+// Err is the error that stopped Next, if any
+func (dr *DigitReader) Err() error {
+	return dr.err
+}
+
+// ReadBatch reads up to size more images, encoded as DataSet.Get encodes
+// them, for zdnn's TrainBatch. At the end of the data it returns an empty
+// batch and io.EOF
+func (dr *DigitReader) ReadBatch(size int) (Batch, error) {
+	var batch Batch
+	for len(batch.Inputs) < size && dr.Next() {
+		input, target := digitSample(dr.image, dr.W*dr.H, dr.classes())
+		batch.Inputs = append(batch.Inputs, input)
+		batch.Targets = append(batch.Targets, target)
+	}
+	if dr.err != nil {
+		return batch, dr.err
+	}
+	if len(batch.Inputs) == 0 {
+		return batch, io.EOF
+	}
+	return batch, nil
+}
+
+// Close closes the files OpenDigitReader opened. It does nothing for a
+// DigitReader from NewDigitReader
+func (dr *DigitReader) Close() error {
+	var err error
+	for _, f := range dr.files {
+		if e := f.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	dr.files = nil
+	return err
+}
+
+// unexpectedEOF is e, but the data ending before all of it was read is unexpected
+func unexpectedEOF(e error) error {
+	if e == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return e
+}
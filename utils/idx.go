@@ -0,0 +1,304 @@
+package utils
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// IDXType is the type of the values in an IDX file, the third byte of its magic number
+type IDXType byte
+
+const (
+	IDXUbyte  IDXType = 0x08
+	IDXByte   IDXType = 0x09
+	IDXShort  IDXType = 0x0B
+	IDXInt    IDXType = 0x0C
+	IDXFloat  IDXType = 0x0D
+	IDXDouble IDXType = 0x0E
+)
+
+// Size is how many bytes each value of the type takes
+func (t IDXType) Size() int {
+	switch t {
+	case IDXUbyte, IDXByte:
+		return 1
+	case IDXShort:
+		return 2
+	case IDXInt, IDXFloat:
+		return 4
+	case IDXDouble:
+		return 8
+	}
+	return 0
+}
+
+func (t IDXType) String() string {
+	switch t {
+	case IDXUbyte:
+		return "ubyte"
+	case IDXByte:
+		return "byte"
+	case IDXShort:
+		return "short"
+	case IDXInt:
+		return "int"
+	case IDXFloat:
+		return "float"
+	case IDXDouble:
+		return "double"
+	}
+	return fmt.Sprintf("IDXType(0x%02x)", byte(t))
+}
+
+// IDX is the contents of an IDX file: an array of Dims, stored in row major
+// order (the last dimension changing fastest) in whichever of the slices
+// matches Type. The others are nil
+type IDX struct {
+	Type IDXType
+	Dims []int
+
+	Ubyte  []uint8
+	Byte   []int8
+	Short  []int16
+	Int    []int32
+	Float  []float32
+	Double []float64
+}
+
+// NewIDX makes a zeroed IDX of the given type and dims, to fill in and write
+func NewIDX(t IDXType, dims ...int) (*IDX, error) {
+	n, err := idxLen(dims)
+	if err != nil {
+		return nil, err
+	}
+	idx := &IDX{Type: t, Dims: dims}
+	switch t {
+	case IDXUbyte:
+		idx.Ubyte = make([]uint8, n)
+	case IDXByte:
+		idx.Byte = make([]int8, n)
+	case IDXShort:
+		idx.Short = make([]int16, n)
+	case IDXInt:
+		idx.Int = make([]int32, n)
+	case IDXFloat:
+		idx.Float = make([]float32, n)
+	case IDXDouble:
+		idx.Double = make([]float64, n)
+	default:
+		return nil, fmt.Errorf("idx: unknown data type %v", t)
+	}
+	return idx, nil
+}
+
+// idxLen is how many values an IDX of dims holds
+func idxLen(dims []int) (int, error) {
+	if len(dims) == 0 || len(dims) > 255 {
+		return 0, fmt.Errorf("idx: can't have %d dimensions", len(dims))
+	}
+	n := 1
+	for i, d := range dims {
+		if d < 0 || int64(d) > math.MaxUint32 {
+			return 0, fmt.Errorf("idx: dimension %d is %d", i, d)
+		}
+		if d != 0 && n > math.MaxInt32/d {
+			return 0, fmt.Errorf("idx: dimensions %v are too large", dims)
+		}
+		n *= d
+	}
+	return n, nil
+}
+
+// Len is how many values there are
+func (idx *IDX) Len() int {
+	n, _ := idxLen(idx.Dims)
+	return n
+}
+
+// At is the i'th value, whatever the type
+func (idx *IDX) At(i int) float64 {
+	switch idx.Type {
+	case IDXUbyte:
+		return float64(idx.Ubyte[i])
+	case IDXByte:
+		return float64(idx.Byte[i])
+	case IDXShort:
+		return float64(idx.Short[i])
+	case IDXInt:
+		return float64(idx.Int[i])
+	case IDXFloat:
+		return float64(idx.Float[i])
+	case IDXDouble:
+		return idx.Double[i]
+	}
+	panic(fmt.Sprintf("idx: unknown data type %v", idx.Type))
+}
+
+// data is the slice holding the values
+func (idx *IDX) data() interface{} {
+	switch idx.Type {
+	case IDXUbyte:
+		return idx.Ubyte
+	case IDXByte:
+		return idx.Byte
+	case IDXShort:
+		return idx.Short
+	case IDXInt:
+		return idx.Int
+	case IDXFloat:
+		return idx.Float
+	case IDXDouble:
+		return idx.Double
+	}
+	return nil
+}
+
+// idxChunk is how many bytes of values ReadIDX reads at a time. The values
+// only take up memory once they've been read, so a header claiming more than
+// the file holds can't make ReadIDX allocate it all up front
+const idxChunk = 1 << 16
+
+// ReadIDX reads an IDX file from r, decompressing it first if it's gzipped
+func ReadIDX(r io.Reader) (*IDX, error) {
+	r, err := decompress(r)
+	if err != nil {
+		return nil, err
+	}
+	t, dims, err := readIDXHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	idx := &IDX{Type: t, Dims: dims}
+	n := idx.Len()
+	size := t.Size()
+	buf := make([]byte, idxChunk)
+	for read := 0; read < n; {
+		k := n - read
+		if k > idxChunk/size {
+			k = idxChunk / size
+		}
+		if _, err := io.ReadFull(r, buf[:k*size]); err != nil {
+			return nil, fmt.Errorf("idx: reading %d %v values: %v", n, t, unexpectedEOF(err))
+		}
+		idx.appendValues(buf[:k*size])
+		read += k
+	}
+	return idx, nil
+}
+
+// appendValues decodes the big endian values in b onto the end of the slice
+// matching idx's type
+func (idx *IDX) appendValues(b []byte) {
+	switch idx.Type {
+	case IDXUbyte:
+		idx.Ubyte = append(idx.Ubyte, b...)
+	case IDXByte:
+		for _, v := range b {
+			idx.Byte = append(idx.Byte, int8(v))
+		}
+	case IDXShort:
+		for i := 0; i < len(b); i += 2 {
+			idx.Short = append(idx.Short, int16(binary.BigEndian.Uint16(b[i:])))
+		}
+	case IDXInt:
+		for i := 0; i < len(b); i += 4 {
+			idx.Int = append(idx.Int, int32(binary.BigEndian.Uint32(b[i:])))
+		}
+	case IDXFloat:
+		for i := 0; i < len(b); i += 4 {
+			idx.Float = append(idx.Float, math.Float32frombits(binary.BigEndian.Uint32(b[i:])))
+		}
+	case IDXDouble:
+		for i := 0; i < len(b); i += 8 {
+			idx.Double = append(idx.Double, math.Float64frombits(binary.BigEndian.Uint64(b[i:])))
+		}
+	}
+}
+
+// readIDXHeader reads the magic number and dimensions at the start of an IDX
+// file, leaving r at the values
+func readIDXHeader(r io.Reader) (IDXType, []int, error) {
+	var magic [4]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil {
+		return 0, nil, fmt.Errorf("idx: reading magic number: %v", err)
+	}
+	if magic[0] != 0 || magic[1] != 0 {
+		return 0, nil, fmt.Errorf("idx: bad magic number 0x%x", magic)
+	}
+	t := IDXType(magic[2])
+	if t.Size() == 0 {
+		return 0, nil, fmt.Errorf("idx: unknown data type %v", t)
+	}
+
+	dims := make([]int, magic[3])
+	for i := range dims {
+		var d uint32
+		if err := binary.Read(r, binary.BigEndian, &d); err != nil {
+			return 0, nil, fmt.Errorf("idx: reading dimension %d: %v", i, err)
+		}
+		dims[i] = int(d)
+	}
+	if _, err := idxLen(dims); err != nil {
+		return 0, nil, err
+	}
+	return t, dims, nil
+}
+
+// ReadIDXFile reads the IDX file at path
+func ReadIDXFile(path string) (*IDX, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	idx, err := ReadIDX(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return idx, nil
+}
+
+// WriteIDX writes idx to w in the IDX format
+func WriteIDX(w io.Writer, idx *IDX) error {
+	n, err := idxLen(idx.Dims)
+	if err != nil {
+		return err
+	}
+	if idx.Type.Size() == 0 {
+		return fmt.Errorf("idx: unknown data type %v", idx.Type)
+	}
+	data := idx.data()
+	if l := binary.Size(data) / idx.Type.Size(); l != n {
+		return fmt.Errorf("idx: dimensions %v need %d values but there are %d", idx.Dims, n, l)
+	}
+
+	header := []byte{0, 0, byte(idx.Type), byte(len(idx.Dims))}
+	for _, d := range idx.Dims {
+		header = append(header, byte(d>>24), byte(d>>16), byte(d>>8), byte(d))
+	}
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if idx.Type == IDXUbyte {
+		_, err = w.Write(idx.Ubyte)
+		return err
+	}
+	return binary.Write(w, binary.BigEndian, data)
+}
+
+// WriteIDXFile writes idx to a new file at path
+func WriteIDXFile(path string, idx *IDX) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := WriteIDX(f, idx); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"bytes"
+	"compress/gzip"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeIDX(t *testing.T, idx *IDX) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := WriteIDX(&buf, idx); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestIDXRoundTrip(t *testing.T) {
+	// more doubles than ReadIDX reads at a time
+	long, err := NewIDX(IDXDouble, 3, idxChunk/8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range long.Double {
+		long.Double[i] = math.Sin(float64(i))
+	}
+
+	tests := []*IDX{
+		{Type: IDXUbyte, Dims: []int{2, 3}, Ubyte: []uint8{0, 1, 127, 128, 200, 255}},
+		{Type: IDXByte, Dims: []int{3, 2}, Byte: []int8{-128, -1, 0, 1, 64, 127}},
+		{Type: IDXShort, Dims: []int{6}, Short: []int16{-32768, -300, 0, 1, 300, 32767}},
+		{Type: IDXInt, Dims: []int{1, 2, 3}, Int: []int32{math.MinInt32, -70000, 0, 1, 70000, math.MaxInt32}},
+		{Type: IDXFloat, Dims: []int{2, 3}, Float: []float32{-1.5, 0, .1, 3e38, -1e-38, float32(math.Inf(1))}},
+		{Type: IDXDouble, Dims: []int{2, 3}, Double: []float64{-1.5, 0, .1, 1e308, -5e-324, math.Inf(-1)}},
+		long,
+	}
+	for _, want := range tests {
+		b := writeIDX(t, want)
+		got, err := ReadIDX(bytes.NewReader(b))
+		if err != nil {
+			t.Errorf("%v: %v", want.Type, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%v %v read back as %v %v", want.Type, want.Dims, got.Type, got.Dims)
+		}
+
+		var zipped bytes.Buffer
+		zw := gzip.NewWriter(&zipped)
+		zw.Write(b)
+		zw.Close()
+		got, err = ReadIDX(&zipped)
+		if err != nil {
+			t.Errorf("gzipped %v: %v", want.Type, err)
+		} else if !reflect.DeepEqual(got, want) {
+			t.Errorf("gzipped %v %v read back as %v %v", want.Type, want.Dims, got.Type, got.Dims)
+		}
+	}
+}
+
+func TestIDXAt(t *testing.T) {
+	idx := &IDX{Type: IDXShort, Dims: []int{2}, Short: []int16{-3, 7}}
+	if idx.Len() != 2 || idx.At(0) != -3 || idx.At(1) != 7 {
+		t.Errorf("short values are %v and %v of %d", idx.At(0), idx.At(1), idx.Len())
+	}
+}
+
+func TestReadIDXErrors(t *testing.T) {
+	valid := writeIDX(t, &IDX{Type: IDXInt, Dims: []int{2, 2}, Int: []int32{1, 2, 3, 4}})
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"empty", nil, "reading magic number"},
+		{"bad magic number", []byte{1, 0, 8, 1, 0, 0, 0, 0}, "bad magic number"},
+		{"unknown type", []byte{0, 0, 7, 1, 0, 0, 0, 0}, "unknown data type"},
+		{"truncated header", valid[:10], "reading dimension 1"},
+		{"truncated values", valid[:len(valid)-1], "reading 4 int values: unexpected EOF"},
+		{"no values", valid[:12], "reading 4 int values: unexpected EOF"},
+		// a header claiming 0xffff*0x7fff shorts with none following
+		{"header claiming more", []byte{0, 0, 0x0B, 2, 0, 0, 0xff, 0xff, 0, 0, 0x7f, 0xff}, "unexpected EOF"},
+		{"too large", []byte{0, 0, 8, 2, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, "too large"},
+	}
+	for _, test := range tests {
+		_, err := ReadIDX(bytes.NewReader(test.data))
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: got error %v, want %q", test.name, err, test.want)
+		}
+	}
+}
+
+func TestWriteIDXErrors(t *testing.T) {
+	tests := []*IDX{
+		{Type: IDXUbyte, Dims: []int{2, 2}, Ubyte: []uint8{1, 2, 3}},
+		{Type: IDXUbyte, Dims: []int{3}, Byte: []int8{1, 2, 3}},
+		{Type: IDXType(7), Dims: []int{1}},
+		{Type: IDXFloat, Dims: nil},
+	}
+	for _, idx := range tests {
+		if err := WriteIDX(&bytes.Buffer{}, idx); err == nil {
+			t.Errorf("wrote %v %v", idx.Type, idx.Dims)
+		}
+	}
+}
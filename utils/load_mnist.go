@@ -4,8 +4,8 @@ package utils
 
 import (
 	"fmt"
+	"io"
 	"os"
-	"path/filepath"
 )
 
 const (
@@ -13,35 +13,8 @@ const (
 	TrainLabelsFile  = "train-labels-idx1-ubyte"
 	TestImagesFile   = "t10k-images-idx3-ubyte"
 	TestLabelsFile   = "t10k-labels-idx1-ubyte"
-
-	labelsFileMagic  = 0x00000801
-	imagesFileMagic  = 0x00000803
-
-	msgInvalidFormat = "Invalid format: %s"
-	msgSizeUnmatch   = "Data size does not match: %s %s"
 )
 
-func fileError(f *os.File) error {
-	return fmt.Errorf(msgInvalidFormat, f.Name())
-}
-
-// internal: Read 4 bytes and convert to big endian integer
-func readInt32(f *os.File) (int, error) {
-	buf := make([]byte, 4)
-	n, e := f.Read(buf)
-	switch {
-	case e != nil:
-		return 0, e
-	case n != 4:
-		return 0, fileError(f)
-	}
-	v := 0
-	for _, x := range buf {
-		v = v * 256 + int(x)
-	}
-	return v, nil
-}
-
 // internal: raw image data
 type imageData struct {
 	N int
@@ -50,35 +23,16 @@ type imageData struct {
 	Data []uint8
 }
 
-func readImagesFile(path string) (*imageData, error) {
-	f, e := os.Open(path)
+func readImages(r io.Reader) (*imageData, error) {
+	idx, e := ReadIDX(r)
 	if e != nil {
 		return nil, e
 	}
-	defer f.Close()
-	magic, e := readInt32(f)
-	if e != nil || magic != imagesFileMagic {
-		return nil, fileError(f)
-	}
-	n, e := readInt32(f)
-	if e != nil {
-		return nil, fileError(f)
-	}
-	w, e := readInt32(f)
-	if e != nil {
-		return nil, fileError(f)
-	}
-	h, e := readInt32(f)
-	if e != nil {
-		return nil, fileError(f)
-	}
-	sz := n * w * h
-	data := &imageData{n, w, h, make([]uint8, sz)}
-	len, e := f.Read(data.Data)
-	if e != nil || len != sz {
-		return nil, fileError(f)
+	if e := checkImages(idx.Type, idx.Dims); e != nil {
+		return nil, e
 	}
-	return data, nil
+	// dimensions are images, rows, columns
+	return &imageData{idx.Dims[0], idx.Dims[2], idx.Dims[1], idx.Ubyte}, nil
 }
 
 // internal: raw label data
@@ -87,29 +41,48 @@ type labelData struct {
 	Data []uint8
 }
 
-func readLabelsFile(path string) (*labelData, error) {
-	f, e := os.Open(path)
+func readLabels(r io.Reader) (*labelData, error) {
+	idx, e := ReadIDX(r)
 	if e != nil {
 		return nil, e
 	}
-	defer f.Close()
-	magic, e := readInt32(f)
-	if e != nil || magic != labelsFileMagic {
-		return nil, fileError(f)
+	if e := checkLabels(idx.Type, idx.Dims); e != nil {
+		return nil, e
+	}
+	return &labelData{idx.Dims[0], idx.Ubyte}, nil
+}
+
+// internal: MNIST images are a ubyte IDX of images by rows by columns
+func checkImages(t IDXType, dims []int) error {
+	if t != IDXUbyte || len(dims) != 3 {
+		return fmt.Errorf("images must be 3 dimensional ubyte, not %d dimensional %v", len(dims), t)
+	}
+	return nil
+}
+
+// internal: MNIST labels are a ubyte IDX of one per image
+func checkLabels(t IDXType, dims []int) error {
+	if t != IDXUbyte || len(dims) != 1 {
+		return fmt.Errorf("labels must be 1 dimensional ubyte, not %d dimensional %v", len(dims), t)
 	}
-	n, e := readInt32(f)
+	return nil
+}
+
+// internal: open path, closing it again if read fails
+func readFile(path string, read func(r io.Reader) error) error {
+	f, e := os.Open(path)
 	if e != nil {
-		return nil, fileError(f)
+		return e
 	}
-	data := &labelData{n, make([]uint8, n)}
-	len, e := f.Read(data.Data)
-	if e != nil || len != n {
-		return nil, fileError(f)
+	defer f.Close()
+	if e := read(f); e != nil {
+		return fmt.Errorf("%s: %v", path, e)
 	}
-	return data, nil
+	return nil
 }
 
-// Single digit+image datum
+// Single digit+image datum. Digit is the label, an index into the data set's
+// LabelNames, and Image is H rows of W pixels for each channel in turn
 type DigitImage struct {
 	Digit int
 	Image [][]uint8
@@ -120,52 +93,150 @@ type DataSet struct {
 	N int
 	W int
 	H int
+	Channels int
+	LabelNames []string
 	Data []DigitImage
 }
 
+// internal: labels of the MNIST digits
+var digitNames = []string{"0", "1", "2", "3", "4", "5", "6", "7", "8", "9"}
+
 // Database readers
+
+// ReadDataSet reads the images and labels files at the paths, either of which
+// may be gzipped. The labels must be digits, 0 to 9
 func ReadDataSet(imagesPath, labelsPath string) (*DataSet, error) {
-	images, e := readImagesFile(imagesPath)
+	return readDataSet(imagesPath, labelsPath, nil, 0)
+}
+
+// internal: ReadDataSet, but with labels taken from labelOffset up to name
+// each of labelNames
+func readDataSet(imagesPath, labelsPath string, labelNames []string, labelOffset int) (*DataSet, error) {
+	var images *imageData
+	var labels *labelData
+	e := readFile(imagesPath, func(r io.Reader) (e error) {
+		images, e = readImages(r)
+		return e
+	})
 	if e != nil {
 		return nil, e
 	}
-	labels, e := readLabelsFile(labelsPath)
+	e = readFile(labelsPath, func(r io.Reader) (e error) {
+		labels, e = readLabels(r)
+		return e
+	})
 	if e != nil {
 		return nil, e
 	}
-	if images.N != images.N {
-		return nil, fmt.Errorf(msgSizeUnmatch, labelsPath, imagesPath)
+	if labels.N != images.N {
+		return nil, fmt.Errorf("%s has %d labels but %s has %d images", labelsPath, labels.N, imagesPath, images.N)
 	}
-	dataSet := &DataSet{N: images.N, W: images.W, H: images.H}
+	dataSet, e := newDataSet(images, labels, labelNames, labelOffset)
+	if e != nil {
+		return nil, fmt.Errorf("%s: %v", labelsPath, e)
+	}
+	return dataSet, nil
+}
+
+// ReadDataSetFrom reads a data set from images and labels in the MNIST IDX
+// format, either of which may be gzipped. The labels must be digits, 0 to 9
+func ReadDataSetFrom(imagesReader, labelsReader io.Reader) (*DataSet, error) {
+	images, e := readImages(imagesReader)
+	if e != nil {
+		return nil, e
+	}
+	labels, e := readLabels(labelsReader)
+	if e != nil {
+		return nil, e
+	}
+	if labels.N != images.N {
+		return nil, fmt.Errorf("%d labels but %d images", labels.N, images.N)
+	}
+	return newDataSet(images, labels, nil, 0)
+}
+
+// internal: pair images with their labels, less labelOffset, checking each is
+// one of the data set's classes
+func newDataSet(images *imageData, labels *labelData, labelNames []string, labelOffset int) (*DataSet, error) {
+	dataSet := &DataSet{N: images.N, W: images.W, H: images.H, Channels: 1, LabelNames: labelNames}
 	dataSet.Data = make([]DigitImage, dataSet.N)
-	rows := splitToRows(images.Data, images.N, images.H)
+	rows := splitToRows(images.Data, images.N*images.H, images.W)
 	for i := 0; i < dataSet.N; i++ {
 		data := &dataSet.Data[i]
-		data.Digit = int(labels.Data[i])
+		data.Digit = int(labels.Data[i]) - labelOffset
+		if e := checkLabel(i, data.Digit, dataSet.classes()); e != nil {
+			return nil, e
+		}
 		data.Image = rows[0:dataSet.H]
 		rows = rows[dataSet.H:]
 	}
 	return dataSet, nil
 }
 
+// ReadTrainSet reads the MNIST training set from dir, in the files as they're
+// distributed (gzipped, ending .gz) or as they are once unzipped
 func ReadTrainSet(dir string) (*DataSet, error) {
-	imagesPath := filepath.Join(dir, TrainImagesFile)
-	labelsPath := filepath.Join(dir, TrainLabelsFile)
-	return ReadDataSet(imagesPath, labelsPath)
+	return readMNISTSet(dir, true, digitNames)
 }
 
+// ReadTestSet reads the MNIST test set from dir, like ReadTrainSet
 func ReadTestSet(dir string) (*DataSet, error) {
-	imagesPath := filepath.Join(dir, TestImagesFile)
-	labelsPath := filepath.Join(dir, TestLabelsFile)
-	return ReadDataSet(imagesPath, labelsPath)
+	return readMNISTSet(dir, false, digitNames)
+}
+
+// internal: read the training or test set of anything distributed with
+// MNIST's filenames, and label it
+func readMNISTSet(dir string, train bool, labelNames []string) (*DataSet, error) {
+	imagesFile, labelsFile := TestImagesFile, TestLabelsFile
+	if train {
+		imagesFile, labelsFile = TrainImagesFile, TrainLabelsFile
+	}
+	return readDataSet(findFile(dir, imagesFile), findFile(dir, labelsFile), labelNames, 0)
+}
+
+// WriteDataSet writes dataSet as a pair of MNIST style IDX files, which
+// ReadDataSet can read back. Only single channel images can be written, and
+// label names are left out
+func WriteDataSet(imagesPath, labelsPath string, dataSet *DataSet) error {
+	if dataSet.Channels > 1 {
+		return fmt.Errorf("can't write %d channel images as MNIST", dataSet.Channels)
+	}
+	images, e := NewIDX(IDXUbyte, len(dataSet.Data), dataSet.H, dataSet.W)
+	if e != nil {
+		return e
+	}
+	labels, e := NewIDX(IDXUbyte, len(dataSet.Data))
+	if e != nil {
+		return e
+	}
+	pixels := images.Ubyte[:0]
+	for i, data := range dataSet.Data {
+		if data.Digit < 0 || data.Digit > 255 {
+			return fmt.Errorf("image %d has label %d, which doesn't fit in a byte", i, data.Digit)
+		}
+		labels.Ubyte[i] = uint8(data.Digit)
+		if len(data.Image) != dataSet.H {
+			return fmt.Errorf("image %d has %d rows, not %d", i, len(data.Image), dataSet.H)
+		}
+		for _, row := range data.Image {
+			if len(row) != dataSet.W {
+				return fmt.Errorf("image %d has a row of %d pixels, not %d", i, len(row), dataSet.W)
+			}
+			pixels = append(pixels, row...)
+		}
+	}
+	if e := WriteIDXFile(imagesPath, images); e != nil {
+		return e
+	}
+	return WriteIDXFile(labelsPath, labels)
 }
 
-func splitToRows(data []uint8, N, H int) [][]uint8 {
-	nR := N * H
+// internal: split data into nR rows of W pixels each
+func splitToRows(data []uint8, nR, W int) [][]uint8 {
 	rows := make([][]uint8, nR)
 	for i := 0; i < nR; i++ {
-		rows[i] = data[0:H]
-		data = data[H:]
+		rows[i] = data[0:W]
+		data = data[W:]
 	}
 	return rows
 }
@@ -0,0 +1,157 @@
+package utils
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// mnistImages are 3 images of 2 rows of 3 pixels, labelled mnistLabels
+var (
+	mnistImages = [][][]uint8{
+		{{0, 10, 20}, {30, 40, 50}},
+		{{255, 0, 255}, {0, 255, 0}},
+		{{1, 2, 3}, {4, 5, 6}},
+	}
+	mnistLabels = []uint8{7, 0, 9}
+)
+
+// mnistFiles are the images and labels files for mnistImages, labelled labels,
+// gzipped if zip is set
+func mnistFiles(t *testing.T, labels []uint8, zip bool) ([]byte, []byte) {
+	t.Helper()
+	img, err := NewIDX(IDXUbyte, len(mnistImages), 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img.Ubyte = img.Ubyte[:0]
+	for _, image := range mnistImages {
+		for _, row := range image {
+			img.Ubyte = append(img.Ubyte, row...)
+		}
+	}
+	lbl := &IDX{Type: IDXUbyte, Dims: []int{len(labels)}, Ubyte: labels}
+
+	files := [2][]byte{}
+	for i, idx := range []*IDX{img, lbl} {
+		var buf bytes.Buffer
+		var w io.Writer = &buf
+		var zw *gzip.Writer
+		if zip {
+			zw = gzip.NewWriter(&buf)
+			w = zw
+		}
+		if err := WriteIDX(w, idx); err != nil {
+			t.Fatal(err)
+		}
+		if zw != nil {
+			zw.Close()
+		}
+		files[i] = buf.Bytes()
+	}
+	return files[0], files[1]
+}
+
+func checkDigits(t *testing.T, name string, digits []DigitImage) {
+	t.Helper()
+	if len(digits) != len(mnistImages) {
+		t.Fatalf("%s: read %d images, want %d", name, len(digits), len(mnistImages))
+	}
+	for i, digit := range digits {
+		if digit.Digit != int(mnistLabels[i]) || !reflect.DeepEqual(digit.Image, mnistImages[i]) {
+			t.Errorf("%s: image %d read as %d %v, want %d %v", name, i, digit.Digit, digit.Image, mnistLabels[i], mnistImages[i])
+		}
+	}
+}
+
+func TestReadDataSetFrom(t *testing.T) {
+	for _, zip := range []bool{false, true} {
+		images, labels := mnistFiles(t, mnistLabels, zip)
+		dataSet, err := ReadDataSetFrom(bytes.NewReader(images), bytes.NewReader(labels))
+		if err != nil {
+			t.Fatalf("gzipped %v: %v", zip, err)
+		}
+		if dataSet.N != 3 || dataSet.W != 3 || dataSet.H != 2 || dataSet.Channels != 1 {
+			t.Errorf("gzipped %v: read %d images of %dx%dx%d", zip, dataSet.N, dataSet.Channels, dataSet.H, dataSet.W)
+		}
+		checkDigits(t, "ReadDataSetFrom", dataSet.Data)
+	}
+}
+
+func TestDigitReader(t *testing.T) {
+	for _, zip := range []bool{false, true} {
+		images, labels := mnistFiles(t, mnistLabels, zip)
+		dr, err := NewDigitReader(bytes.NewReader(images), bytes.NewReader(labels))
+		if err != nil {
+			t.Fatalf("gzipped %v: %v", zip, err)
+		}
+		if dr.N != 3 || dr.W != 3 || dr.H != 2 {
+			t.Errorf("gzipped %v: reading %d images of %dx%d", zip, dr.N, dr.H, dr.W)
+		}
+		var digits []DigitImage
+		for dr.Next() {
+			digits = append(digits, dr.Image())
+		}
+		if err := dr.Err(); err != nil {
+			t.Fatalf("gzipped %v: %v", zip, err)
+		}
+		checkDigits(t, "DigitReader", digits)
+	}
+}
+
+func TestDigitReaderBatches(t *testing.T) {
+	images, labels := mnistFiles(t, mnistLabels, false)
+	dr, err := NewDigitReader(bytes.NewReader(images), bytes.NewReader(labels))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []int{2, 1} {
+		batch, err := dr.ReadBatch(2)
+		if err != nil || len(batch.Inputs) != want || len(batch.Targets) != want {
+			t.Fatalf("read a batch of %d (%v), want %d", len(batch.Inputs), err, want)
+		}
+	}
+	if batch, err := dr.ReadBatch(2); err != io.EOF || len(batch.Inputs) != 0 {
+		t.Errorf("read a batch of %d (%v) at the end, want io.EOF", len(batch.Inputs), err)
+	}
+}
+
+func TestMNISTLabelOutOfRange(t *testing.T) {
+	const want = "image 1 has label 10 of 10"
+	bad := []uint8{7, 10, 9}
+	for _, zip := range []bool{false, true} {
+		images, labels := mnistFiles(t, bad, zip)
+		if _, err := ReadDataSetFrom(bytes.NewReader(images), bytes.NewReader(labels)); err == nil || err.Error() != want {
+			t.Errorf("ReadDataSetFrom, gzipped %v: got error %v, want %q", zip, err, want)
+		}
+
+		dr, err := NewDigitReader(bytes.NewReader(images), bytes.NewReader(labels))
+		if err != nil {
+			t.Fatal(err)
+		}
+		read := 0
+		for dr.Next() {
+			read++
+		}
+		if read != 1 || dr.Err() == nil || dr.Err().Error() != want {
+			t.Errorf("DigitReader, gzipped %v: read %d images then got error %v, want %q", zip, read, dr.Err(), want)
+		}
+	}
+}
+
+func TestMNISTMismatchedFiles(t *testing.T) {
+	images, labels := mnistFiles(t, mnistLabels[:2], false)
+	if _, err := ReadDataSetFrom(bytes.NewReader(images), bytes.NewReader(labels)); err == nil || !strings.Contains(err.Error(), "2 labels but 3 images") {
+		t.Errorf("ReadDataSetFrom got error %v", err)
+	}
+	if _, err := NewDigitReader(bytes.NewReader(images), bytes.NewReader(labels)); err == nil || !strings.Contains(err.Error(), "2 labels but 3 images") {
+		t.Errorf("NewDigitReader got error %v", err)
+	}
+	// labels where the images should be
+	if _, err := ReadDataSetFrom(bytes.NewReader(labels), bytes.NewReader(labels)); err == nil {
+		t.Errorf("read labels as images")
+	}
+}
@@ -0,0 +1,171 @@
+package utils
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// LoaderConfig is the configuration for a DataLoader
+type LoaderConfig struct {
+	// BatchSize is how many samples go in each batch (default 32)
+	BatchSize int
+
+	// Shuffle reorders the samples at the start of every pass, drawing from a
+	// source seeded with Seed so the order is the same from run to run
+	Shuffle bool
+	Seed    int64
+
+	// DropLast leaves out the last batch if there aren't enough samples left
+	// to fill it
+	DropLast bool
+
+	// Prefetch is how many batches are assembled ahead of the one being used,
+	// each on its own goroutine. With 0 each batch is assembled when asked for
+	Prefetch int
+}
+
+// DataLoader splits a Dataset into batches, one pass of it at a time
+type DataLoader struct {
+	dataset Dataset
+	config  LoaderConfig
+	rng     *rand.Rand
+}
+
+// Batch is a run of samples from a Dataset, inputs paired with targets by index
+type Batch struct {
+	Inputs  [][]float64
+	Targets [][]float64
+}
+
+// NewDataLoader builds a loader over dataset from a config object
+func NewDataLoader(dataset Dataset, config LoaderConfig) (*DataLoader, error) {
+	if config.BatchSize == 0 {
+		config.BatchSize = 32
+	}
+	if config.BatchSize < 0 {
+		return nil, fmt.Errorf("batch size %d is negative", config.BatchSize)
+	}
+	if config.Prefetch < 0 {
+		return nil, fmt.Errorf("prefetch %d is negative", config.Prefetch)
+	}
+	return &DataLoader{dataset: dataset, config: config, rng: rand.New(rand.NewSource(config.Seed))}, nil
+}
+
+// Len is how many batches each pass yields
+func (dl *DataLoader) Len() int {
+	n := dl.dataset.Len() / dl.config.BatchSize
+	if !dl.config.DropLast && dl.dataset.Len()%dl.config.BatchSize != 0 {
+		n++
+	}
+	return n
+}
+
+// Iter starts a pass over the dataset, shuffled first if the loader shuffles.
+// Passes run one after another; Close the last one before starting another
+func (dl *DataLoader) Iter() *BatchIter {
+	order := make([]int, dl.dataset.Len())
+	for i := range order {
+		order[i] = i
+	}
+	if dl.config.Shuffle {
+		dl.rng.Shuffle(len(order), func(i, j int) {
+			order[i], order[j] = order[j], order[i]
+		})
+	}
+
+	it := &BatchIter{loader: dl, order: order}
+	if dl.config.Prefetch > 0 {
+		it.pending = make(chan chan Batch, dl.config.Prefetch)
+		it.done = make(chan struct{})
+		go it.prefetch()
+	}
+	return it
+}
+
+// BatchIter steps through the batches of one pass of a DataLoader:
+//
+//	it := loader.Iter()
+//	defer it.Close()
+//	for it.Next() {
+//		batch := it.Batch()
+//		...
+//	}
+type BatchIter struct {
+	loader *DataLoader
+	order  []int
+	next   int
+	batch  Batch
+
+	// batches being assembled in the background, in order, when prefetching
+	pending chan chan Batch
+	done    chan struct{}
+	closed  bool
+}
+
+// Next moves on to the next batch, reporting false when the pass is over
+func (it *BatchIter) Next() bool {
+	if it.closed {
+		return false
+	}
+	if it.pending != nil {
+		b, ok := <-it.pending
+		if !ok {
+			return false
+		}
+		it.batch = <-b
+		return true
+	}
+	if it.next >= it.loader.Len() {
+		return false
+	}
+	it.batch = it.assemble(it.next)
+	it.next++
+	return true
+}
+
+// Batch is the current batch
+func (it *BatchIter) Batch() Batch {
+	return it.batch
+}
+
+// Close stops any batches being assembled ahead
+func (it *BatchIter) Close() {
+	if it.closed {
+		return
+	}
+	it.closed = true
+	if it.done != nil {
+		close(it.done)
+	}
+}
+
+// prefetch starts assembling each batch in turn, up to Prefetch of them ahead
+// of Next
+func (it *BatchIter) prefetch() {
+	defer close(it.pending)
+	for k := 0; k < it.loader.Len(); k++ {
+		b := make(chan Batch, 1)
+		select {
+		case it.pending <- b:
+		case <-it.done:
+			return
+		}
+		go func(k int) {
+			b <- it.assemble(k)
+		}(k)
+	}
+}
+
+// assemble reads the k'th batch of the pass from the dataset
+func (it *BatchIter) assemble(k int) Batch {
+	size := it.loader.config.BatchSize
+	indices := it.order[k*size:]
+	if len(indices) > size {
+		indices = indices[:size]
+	}
+	batch := Batch{Inputs: make([][]float64, len(indices)), Targets: make([][]float64, len(indices))}
+	for i, idx := range indices {
+		batch.Inputs[i], batch.Targets[i] = it.loader.dataset.Get(idx)
+	}
+	return batch
+}
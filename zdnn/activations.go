@@ -1,10 +1,11 @@
 package zdnn
 
 import (
+	"fmt"
 	"math"
 
+	"gonum.org/v1/gonum/floats"
 	"gonum.org/v1/gonum/mat"
-	// "fmt"
 )
 
 type Activation int
@@ -13,27 +14,126 @@ const (
 	Sigmoid Activation = iota
 	ReLU
 	Softmax
+	Tanh
+	LeakyReLU
+	PReLU
+	ELU
+	SELU
+	GELU
+	Swish
+	Softplus
+	Linear
 )
 
+// IActivation is an activation function applied to a layer's weighted input z.
+// ApplyPrime is its element-wise derivative, which some activations compute more
+// easily from z and others from the output, so PrimeInput says which it takes
 type IActivation interface {
 	Apply(mat.Matrix) mat.Matrix
 	ApplyPrime(mat.Matrix) mat.Matrix
+	PrimeInput() PrimeInput
+}
+
+// PrimeInput is what an activation's derivative is a function of
+type PrimeInput int
+
+const (
+	// PreActivation derivatives take the weighted input z
+	PreActivation PrimeInput = iota
+	// PostActivation derivatives take the output, Apply(z)
+	PostActivation
+)
+
+// JacobianActivation is an activation whose outputs each depend on the whole
+// column (like softmax), so its derivative can't be applied element-wise
+type JacobianActivation interface {
+	IActivation
+	// BackProp multiplies grad by the activation's jacobian, column by column,
+	// taking z or the output as PrimeInput says
+	BackProp(in, grad mat.Matrix) mat.Matrix
+}
+
+// ParamActivation is an activation with trainable parameters of its own (like PReLU)
+type ParamActivation interface {
+	IActivation
+	Params() []*mat.Dense
+	// ParamGrads gives the loss gradient of each param, summed over the batch,
+	// from the weighted input z and the loss gradient at the output
+	ParamGrads(z, grad mat.Matrix) []*mat.Dense
 }
 
 type SigmoidStruct struct{}
 type ReLUStruct struct{}
 type SoftmaxStruct struct{}
+type TanhStruct struct{}
+type LeakyReLUStruct struct{}
+type ELUStruct struct{}
+type SELUStruct struct{}
+type GELUStruct struct{}
+type SwishStruct struct{}
+type SoftplusStruct struct{}
+type LinearStruct struct{}
 
-func NewActivation(opt Activation) IActivation {
+// PReLUStruct is a leaky ReLU that learns its negative slope
+type PReLUStruct struct {
+	alpha *mat.Dense
+}
+
+const (
+	// slope of LeakyReLU below 0, and where PReLU's learned slope starts
+	leakySlope     = 0.01
+	preluInitSlope = 0.25
+
+	eluAlpha = 1.0
+
+	// SELU constants from Klambauer et al., chosen so activations self-normalize
+	seluAlpha = 1.6732632423543772
+	seluScale = 1.0507009873554805
+)
+
+// NewActivation builds the activation for opt, or errors if there isn't one
+func NewActivation(opt Activation) (IActivation, error) {
 	switch opt {
 	case Sigmoid:
-		return SigmoidStruct{}
+		return SigmoidStruct{}, nil
 	case ReLU:
-		return ReLUStruct{}
-		// case Softmax:
-		// 	return SoftmaxStruct{}
+		return ReLUStruct{}, nil
+	case Softmax:
+		return SoftmaxStruct{}, nil
+	case Tanh:
+		return TanhStruct{}, nil
+	case LeakyReLU:
+		return LeakyReLUStruct{}, nil
+	case PReLU:
+		return &PReLUStruct{alpha: mat.NewDense(1, 1, []float64{preluInitSlope})}, nil
+	case ELU:
+		return ELUStruct{}, nil
+	case SELU:
+		return SELUStruct{}, nil
+	case GELU:
+		return GELUStruct{}, nil
+	case Swish:
+		return SwishStruct{}, nil
+	case Softplus:
+		return SoftplusStruct{}, nil
+	case Linear:
+		return LinearStruct{}, nil
 	}
-	return nil
+	return nil, fmt.Errorf("unknown activation %d", opt)
+}
+
+// backpropActivation carries grad back through act, given the layer's weighted
+// input z and output, using the full jacobian when the activation needs it and
+// an element-wise product otherwise
+func backpropActivation(act IActivation, z, output, grad mat.Matrix) *mat.Dense {
+	in := z
+	if act.PrimeInput() == PostActivation {
+		in = output
+	}
+	if j, ok := act.(JacobianActivation); ok {
+		return j.BackProp(in, grad).(*mat.Dense)
+	}
+	return Mult(grad, act.ApplyPrime(in)).(*mat.Dense)
 }
 
 func (s SigmoidStruct) Apply(m mat.Matrix) mat.Matrix {
@@ -41,6 +141,8 @@ func (s SigmoidStruct) Apply(m mat.Matrix) mat.Matrix {
 	return Apply(apply, m)
 }
 
+func (s SigmoidStruct) PrimeInput() PrimeInput { return PreActivation }
+
 // sigmoid squishification function
 func sigmoid(num float64) float64 {
 	return 1.0 / (1.0 + math.Exp(-num))
@@ -61,6 +163,8 @@ func (r ReLUStruct) Apply(m mat.Matrix) mat.Matrix {
 	return Apply(apply, m)
 }
 
+func (r ReLUStruct) PrimeInput() PrimeInput { return PreActivation }
+
 // (Rectified Linear Units) returns 0 if negative, or the number
 func relu(num float64) float64 {
 	return math.Max(0.0, num)
@@ -79,18 +183,231 @@ func reluPrime(num float64) float64 {
 	return 1.0
 }
 
-// func (s SoftmaxStruct) Apply(m mat.Matrix) mat.Matrix {
-// 	max := mat.Max(m)
-// 	eXMat := Apply(func(_, _ int, val float64) float64 { return math.Exp(val - max) }, m)
-// 	apply := func(_, _ int, val float64) float64 { return softmax(val, mat.Max(eXMat)) }
-// 	return Apply(apply, eXMat)
-// }
+// Apply softmax to each column on its own, so every sample sums to 1
+func (s SoftmaxStruct) Apply(m mat.Matrix) mat.Matrix {
+	r, c := m.Dims()
+	o := mat.NewDense(r, c, nil)
+	col := make([]float64, r)
+	for j := 0; j < c; j++ {
+		mat.Col(col, j, m)
+		softmax(col)
+		o.SetCol(j, col)
+	}
+	return o
+}
+
+// softmax in place, shifted by the max so exp can't overflow
+func softmax(vals []float64) {
+	max := math.Inf(-1)
+	for _, v := range vals {
+		max = math.Max(max, v)
+	}
+	sum := 0.0
+	for i, v := range vals {
+		vals[i] = math.Exp(v - max)
+		sum += vals[i]
+	}
+	for i := range vals {
+		vals[i] /= sum
+	}
+}
+
+func (s SoftmaxStruct) PrimeInput() PrimeInput { return PostActivation }
+
+// ApplyPrime takes the softmax output and returns the diagonal of its jacobian,
+// s * (1 - s). Backprop goes through BackProp instead, which uses the full jacobian
+func (s SoftmaxStruct) ApplyPrime(m mat.Matrix) mat.Matrix {
+	apply := func(_, _ int, val float64) float64 { return val * (1.0 - val) }
+	return Apply(apply, m)
+}
+
+// BackProp for softmax: per column, J^T g = s * (g - s.g)
+func (s SoftmaxStruct) BackProp(output, grad mat.Matrix) mat.Matrix {
+	r, c := output.Dims()
+	o := mat.NewDense(r, c, nil)
+	sCol := make([]float64, r)
+	gCol := make([]float64, r)
+	for j := 0; j < c; j++ {
+		mat.Col(sCol, j, output)
+		mat.Col(gCol, j, grad)
+		dot := floats.Dot(sCol, gCol)
+		for i := range gCol {
+			gCol[i] = sCol[i] * (gCol[i] - dot)
+		}
+		o.SetCol(j, gCol)
+	}
+	return o
+}
+
+func (t TanhStruct) PrimeInput() PrimeInput { return PostActivation }
+
+func (t TanhStruct) Apply(m mat.Matrix) mat.Matrix {
+	apply := func(_, _ int, val float64) float64 { return math.Tanh(val) }
+	return Apply(apply, m)
+}
+
+// derivative of tanh from its output: 1 - tanh^2
+func (t TanhStruct) ApplyPrime(m mat.Matrix) mat.Matrix {
+	apply := func(_, _ int, val float64) float64 { return 1.0 - val*val }
+	return Apply(apply, m)
+}
+
+func (l LeakyReLUStruct) PrimeInput() PrimeInput { return PreActivation }
+
+func (l LeakyReLUStruct) Apply(m mat.Matrix) mat.Matrix {
+	apply := func(_, _ int, val float64) float64 { return leakyRelu(val, leakySlope) }
+	return Apply(apply, m)
+}
+
+func (l LeakyReLUStruct) ApplyPrime(m mat.Matrix) mat.Matrix {
+	apply := func(_, _ int, val float64) float64 { return leakyReluPrime(val, leakySlope) }
+	return Apply(apply, m)
+}
+
+// ReLU that lets a small slope of negatives through
+func leakyRelu(num, slope float64) float64 {
+	if num < 0.0 {
+		return slope * num
+	}
+	return num
+}
+
+func leakyReluPrime(num, slope float64) float64 {
+	if num < 0.0 {
+		return slope
+	}
+	return 1.0
+}
+
+func (p *PReLUStruct) PrimeInput() PrimeInput { return PreActivation }
+
+func (p *PReLUStruct) Apply(m mat.Matrix) mat.Matrix {
+	slope := p.alpha.At(0, 0)
+	apply := func(_, _ int, val float64) float64 { return leakyRelu(val, slope) }
+	return Apply(apply, m)
+}
+
+func (p *PReLUStruct) ApplyPrime(m mat.Matrix) mat.Matrix {
+	slope := p.alpha.At(0, 0)
+	apply := func(_, _ int, val float64) float64 { return leakyReluPrime(val, slope) }
+	return Apply(apply, m)
+}
+
+// Params is the 1x1 learned slope
+func (p *PReLUStruct) Params() []*mat.Dense {
+	return []*mat.Dense{p.alpha}
+}
+
+// ParamGrads for the slope: the output gradient summed over every negative z
+func (p *PReLUStruct) ParamGrads(z, grad mat.Matrix) []*mat.Dense {
+	r, c := z.Dims()
+	sum := 0.0
+	for i := 0; i < r; i++ {
+		for j := 0; j < c; j++ {
+			if v := z.At(i, j); v < 0.0 {
+				sum += v * grad.At(i, j)
+			}
+		}
+	}
+	return []*mat.Dense{mat.NewDense(1, 1, []float64{sum})}
+}
+
+func (e ELUStruct) PrimeInput() PrimeInput { return PreActivation }
+
+func (e ELUStruct) Apply(m mat.Matrix) mat.Matrix {
+	apply := func(_, _ int, val float64) float64 { return elu(val, eluAlpha) }
+	return Apply(apply, m)
+}
+
+func (e ELUStruct) ApplyPrime(m mat.Matrix) mat.Matrix {
+	apply := func(_, _ int, val float64) float64 { return eluPrime(val, eluAlpha) }
+	return Apply(apply, m)
+}
+
+// (Exponential Linear Units) smooth alpha * (e^x - 1) below 0, the number above
+func elu(num, alpha float64) float64 {
+	if num < 0.0 {
+		return alpha * math.Expm1(num)
+	}
+	return num
+}
+
+func eluPrime(num, alpha float64) float64 {
+	if num < 0.0 {
+		return alpha * math.Exp(num)
+	}
+	return 1.0
+}
+
+func (s SELUStruct) PrimeInput() PrimeInput { return PreActivation }
 
-// func softmax(val, sum float64) float64 {
-// 	return val / sum
-// }
+// scaled ELU
+func (s SELUStruct) Apply(m mat.Matrix) mat.Matrix {
+	apply := func(_, _ int, val float64) float64 { return seluScale * elu(val, seluAlpha) }
+	return Apply(apply, m)
+}
+
+func (s SELUStruct) ApplyPrime(m mat.Matrix) mat.Matrix {
+	apply := func(_, _ int, val float64) float64 { return seluScale * eluPrime(val, seluAlpha) }
+	return Apply(apply, m)
+}
 
-// func (s SoftmaxStruct) ApplyPrime(m mat.Matrix) mat.Matrix {
-// 	apply := func(_, _ int, val float64) float64 { return reluPrime(val) }
-// 	return Apply(apply, m)
-// }
+func (g GELUStruct) PrimeInput() PrimeInput { return PreActivation }
+
+// (Gaussian Error Linear Units) x * P(X <= x) for standard normal X
+func (g GELUStruct) Apply(m mat.Matrix) mat.Matrix {
+	apply := func(_, _ int, val float64) float64 { return val * normalCDF(val) }
+	return Apply(apply, m)
+}
+
+// derivative of GELU: cdf(x) + x * pdf(x)
+func (g GELUStruct) ApplyPrime(m mat.Matrix) mat.Matrix {
+	apply := func(_, _ int, val float64) float64 {
+		return normalCDF(val) + val*math.Exp(-val*val/2)/math.Sqrt(2*math.Pi)
+	}
+	return Apply(apply, m)
+}
+
+func normalCDF(num float64) float64 {
+	return 0.5 * (1.0 + math.Erf(num/math.Sqrt2))
+}
+
+func (s SwishStruct) PrimeInput() PrimeInput { return PreActivation }
+
+// x * sigmoid(x)
+func (s SwishStruct) Apply(m mat.Matrix) mat.Matrix {
+	apply := func(_, _ int, val float64) float64 { return val * sigmoid(val) }
+	return Apply(apply, m)
+}
+
+// derivative of swish: sigmoid(x) + x * sigmoid'(x)
+func (s SwishStruct) ApplyPrime(m mat.Matrix) mat.Matrix {
+	apply := func(_, _ int, val float64) float64 { return sigmoid(val) + val*sigmoidPrime(val) }
+	return Apply(apply, m)
+}
+
+func (s SoftplusStruct) PrimeInput() PrimeInput { return PreActivation }
+
+// log(1 + e^x), written so large x can't overflow
+func (s SoftplusStruct) Apply(m mat.Matrix) mat.Matrix {
+	apply := func(_, _ int, val float64) float64 { return math.Max(val, 0.0) + math.Log1p(math.Exp(-math.Abs(val))) }
+	return Apply(apply, m)
+}
+
+// derivative of softplus is the sigmoid
+func (s SoftplusStruct) ApplyPrime(m mat.Matrix) mat.Matrix {
+	apply := func(_, _ int, val float64) float64 { return sigmoid(val) }
+	return Apply(apply, m)
+}
+
+func (l LinearStruct) PrimeInput() PrimeInput { return PreActivation }
+
+// identity, for regression outputs
+func (l LinearStruct) Apply(m mat.Matrix) mat.Matrix {
+	return mat.DenseCopyOf(m)
+}
+
+func (l LinearStruct) ApplyPrime(m mat.Matrix) mat.Matrix {
+	apply := func(_, _ int, _ float64) float64 { return 1.0 }
+	return Apply(apply, m)
+}
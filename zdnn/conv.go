@@ -0,0 +1,384 @@
+package zdnn
+
+import (
+	"fmt"
+	"math/rand"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Conv2DConfig is the configuration for a Conv2D layer. Sizes are {height, width}
+type Conv2DConfig struct {
+	// Filters is how many kernels the layer learns, and so how many channels it outputs
+	Filters int
+	Kernel  [2]int
+
+	// Stride is how far the kernel moves each step (default 1), and Padding
+	// how many rows and columns of zeros surround the input
+	Stride  [2]int
+	Padding [2]int
+
+	// Initializer and BiasInitializer set the starting kernels and bias. Left
+	// nil, both are uniform in +-1/sqrt(fan in), the fan in being the size of
+	// one kernel over every input channel
+	Initializer     Initializer
+	BiasInitializer Initializer
+
+	// Regularization, if set, replaces the network's for this layer
+	Regularization *Regularization
+}
+
+// Conv2D slides Filters kernels over image-like input (see Shape), each one
+// giving an output channel. Like a dense layer it has a bias per output
+// channel but no activation; follow it with an ActivationLayer
+type Conv2D struct {
+	config  Conv2DConfig
+	stride  [2]int
+	input   Shape
+	output  Shape
+	kernels *mat.Dense
+	bias    *mat.Dense
+
+	// kept from the forward pass for backprop: the input unrolled into one
+	// column per kernel position per sample
+	cols    *mat.Dense
+	samples int
+
+	// from the last backward pass
+	grads []*mat.Dense
+}
+
+// NewConv2D builds a convolution layer from a config object
+func NewConv2D(config Conv2DConfig) (*Conv2D, error) {
+	if config.Filters < 1 {
+		return nil, fmt.Errorf("conv layer has %d filters", config.Filters)
+	}
+	if config.Kernel[0] < 1 || config.Kernel[1] < 1 {
+		return nil, fmt.Errorf("conv kernel is %dx%d", config.Kernel[0], config.Kernel[1])
+	}
+	if config.Stride[0] < 0 || config.Stride[1] < 0 || config.Padding[0] < 0 || config.Padding[1] < 0 {
+		return nil, fmt.Errorf("conv stride and padding can't be negative")
+	}
+	stride := config.Stride
+	for k := range stride {
+		if stride[k] == 0 {
+			stride[k] = 1
+		}
+	}
+	return &Conv2D{config: config, stride: stride}, nil
+}
+
+// Build treats the input as a single 1 pixel high row of channels
+func (cl *Conv2D) Build(inputSize int, rng *rand.Rand) (int, error) {
+	s, err := cl.BuildShape(flat(inputSize), rng)
+	return s.Size(), err
+}
+
+// BuildShape creates the kernels, one row per filter, and bias for input
+func (cl *Conv2D) BuildShape(input Shape, rng *rand.Rand) (Shape, error) {
+	kh, kw := cl.config.Kernel[0], cl.config.Kernel[1]
+	cl.input = input
+	cl.output = Shape{
+		Channels: cl.config.Filters,
+		Height:   outputSize(input.Height, kh, cl.stride[0], cl.config.Padding[0]),
+		Width:    outputSize(input.Width, kw, cl.stride[1], cl.config.Padding[1]),
+	}
+	if cl.output.Height < 1 || cl.output.Width < 1 {
+		return Shape{}, fmt.Errorf("%dx%d kernel doesn't fit %v input", kh, kw, input)
+	}
+
+	fanIn := input.Channels * kh * kw
+	fanOut := cl.config.Filters * kh * kw
+
+	cl.kernels = mat.NewDense(cl.config.Filters, fanIn, nil)
+	weightInit := cl.config.Initializer
+	if weightInit == nil {
+		weightInit = fanInUniform{}
+	}
+	weightInit.Init(cl.kernels, fanIn, fanOut, rng)
+
+	cl.bias = mat.NewDense(cl.config.Filters, 1, nil)
+	biasInit := cl.config.BiasInitializer
+	if biasInit == nil {
+		biasInit = fanInUniform{}
+	}
+	biasInit.Init(cl.bias, fanIn, fanOut, rng)
+
+	return cl.output, nil
+}
+
+// Forward unrolls every kernel sized patch of the input into a column (im2col),
+// so the whole batch is convolved by one matrix product with the kernels
+func (cl *Conv2D) Forward(input *mat.Dense, mode Mode, rng *rand.Rand) *mat.Dense {
+	_, cl.samples = input.Dims()
+	cl.cols = cl.im2col(input)
+
+	// one row per filter, one column per output pixel of each sample in turn
+	product := Dot(cl.kernels, cl.cols)
+
+	pixels := cl.output.Height * cl.output.Width
+	out := mat.NewDense(cl.output.Size(), cl.samples, nil)
+	out.Apply(func(i, j int, _ float64) float64 {
+		f, p := i/pixels, i%pixels
+		return product.At(f, j*pixels+p) + cl.bias.At(f, 0)
+	}, out)
+	return out
+}
+
+func (cl *Conv2D) Backward(dOutput *mat.Dense) *mat.Dense {
+	// back to one row per filter, as the product in Forward came out
+	pixels := cl.output.Height * cl.output.Width
+	dProduct := mat.NewDense(cl.config.Filters, pixels*cl.samples, nil)
+	dProduct.Apply(func(f, col int, _ float64) float64 {
+		return dOutput.At(f*pixels+col%pixels, col/pixels)
+	}, dProduct)
+
+	cl.grads = []*mat.Dense{
+		Dot(dProduct, cl.cols.T()).(*mat.Dense),
+		sumAlongAxis(1, dProduct),
+	}
+	return cl.col2im(Dot(cl.kernels.T(), dProduct).(*mat.Dense))
+}
+
+// Params are the kernels then the bias
+func (cl *Conv2D) Params() []*mat.Dense {
+	return []*mat.Dense{cl.kernels, cl.bias}
+}
+
+func (cl *Conv2D) Grads() []*mat.Dense {
+	return cl.grads
+}
+
+// IsWeight is only true of the kernels
+func (cl *Conv2D) IsWeight(k int) bool {
+	return k == 0
+}
+
+func (cl *Conv2D) Regularization() *Regularization {
+	return cl.config.Regularization
+}
+
+func (cl *Conv2D) paramNames() []string {
+	return []string{"kernels", "bias"}
+}
+
+func (cl *Conv2D) Replica() Layer {
+	return &Conv2D{config: cl.config, stride: cl.stride, input: cl.input, output: cl.output, kernels: cl.kernels, bias: cl.bias}
+}
+
+// im2col lays each kernel sized patch of the input out as a column: row
+// (c, ki, kj) of the column for output pixel (oy, ox) is input pixel
+// (c, oy*stride + ki - padding, ox*stride + kj - padding), or 0 in the padding
+func (cl *Conv2D) im2col(input *mat.Dense) *mat.Dense {
+	kh, kw := cl.config.Kernel[0], cl.config.Kernel[1]
+	pixels := cl.output.Height * cl.output.Width
+	cols := mat.NewDense(cl.input.Channels*kh*kw, pixels*cl.samples, nil)
+	cl.eachTap(func(row, col, in, sample int) {
+		cols.Set(row, col, input.At(in, sample))
+	})
+	return cols
+}
+
+// col2im is the reverse of im2col, summing the gradient of every column
+// back onto the input pixel it came from
+func (cl *Conv2D) col2im(dCols *mat.Dense) *mat.Dense {
+	dInput := mat.NewDense(cl.input.Size(), cl.samples, nil)
+	cl.eachTap(func(row, col, in, sample int) {
+		dInput.Set(in, sample, dInput.At(in, sample)+dCols.At(row, col))
+	})
+	return dInput
+}
+
+// eachTap calls fn for every entry of the unrolled input that lands on the
+// input rather than its padding, with the row and column of the unrolled
+// input and the row and column (sample) of the input it comes from
+func (cl *Conv2D) eachTap(fn func(row, col, in, sample int)) {
+	kh, kw := cl.config.Kernel[0], cl.config.Kernel[1]
+	ih, iw := cl.input.Height, cl.input.Width
+	oh, ow := cl.output.Height, cl.output.Width
+	for s := 0; s < cl.samples; s++ {
+		for oy := 0; oy < oh; oy++ {
+			for ox := 0; ox < ow; ox++ {
+				col := (s*oh+oy)*ow + ox
+				for c := 0; c < cl.input.Channels; c++ {
+					for ki := 0; ki < kh; ki++ {
+						y := oy*cl.stride[0] + ki - cl.config.Padding[0]
+						if y < 0 || y >= ih {
+							continue
+						}
+						for kj := 0; kj < kw; kj++ {
+							x := ox*cl.stride[1] + kj - cl.config.Padding[1]
+							if x < 0 || x >= iw {
+								continue
+							}
+							fn((c*kh+ki)*kw+kj, col, (c*ih+y)*iw+x, s)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// PoolConfig is the configuration for a pooling layer. Sizes are {height, width}
+type PoolConfig struct {
+	Size [2]int
+
+	// Stride is how far the window moves each step, Size if left zero
+	Stride [2]int
+}
+
+// Pool2D downsamples each channel of image-like input (see Shape) by taking
+// the max or average of each window. It has no params
+type Pool2D struct {
+	max    bool
+	size   [2]int
+	stride [2]int
+	input  Shape
+	output Shape
+
+	// kept from the forward pass for backprop: for max pooling, the input row
+	// each output came from
+	argmax  [][]int
+	samples int
+}
+
+// NewMaxPool2D builds a layer keeping the largest value in each window
+func NewMaxPool2D(config PoolConfig) (*Pool2D, error) {
+	return newPool(true, config)
+}
+
+// NewAvgPool2D builds a layer averaging each window
+func NewAvgPool2D(config PoolConfig) (*Pool2D, error) {
+	return newPool(false, config)
+}
+
+func newPool(max bool, config PoolConfig) (*Pool2D, error) {
+	if config.Size[0] < 1 || config.Size[1] < 1 {
+		return nil, fmt.Errorf("pool size is %dx%d", config.Size[0], config.Size[1])
+	}
+	if config.Stride[0] < 0 || config.Stride[1] < 0 {
+		return nil, fmt.Errorf("pool stride can't be negative")
+	}
+	stride := config.Stride
+	for k := range stride {
+		if stride[k] == 0 {
+			stride[k] = config.Size[k]
+		}
+	}
+	return &Pool2D{max: max, size: config.Size, stride: stride}, nil
+}
+
+func (pl *Pool2D) Build(inputSize int, rng *rand.Rand) (int, error) {
+	s, err := pl.BuildShape(flat(inputSize), rng)
+	return s.Size(), err
+}
+
+// BuildShape works out the pooled shape, the channel count unchanged
+func (pl *Pool2D) BuildShape(input Shape, rng *rand.Rand) (Shape, error) {
+	pl.input = input
+	pl.output = Shape{
+		Channels: input.Channels,
+		Height:   outputSize(input.Height, pl.size[0], pl.stride[0], 0),
+		Width:    outputSize(input.Width, pl.size[1], pl.stride[1], 0),
+	}
+	if pl.output.Height < 1 || pl.output.Width < 1 {
+		return Shape{}, fmt.Errorf("%dx%d pool doesn't fit %v input", pl.size[0], pl.size[1], input)
+	}
+	return pl.output, nil
+}
+
+func (pl *Pool2D) Forward(input *mat.Dense, mode Mode, rng *rand.Rand) *mat.Dense {
+	_, pl.samples = input.Dims()
+	out := mat.NewDense(pl.output.Size(), pl.samples, nil)
+
+	area := float64(pl.size[0] * pl.size[1])
+	if pl.max {
+		pl.argmax = make([][]int, pl.samples)
+		for s := range pl.argmax {
+			pl.argmax[s] = make([]int, pl.output.Size())
+		}
+	}
+
+	pl.eachWindow(func(o, s int, window []int) {
+		if !pl.max {
+			sum := 0.0
+			for _, in := range window {
+				sum += input.At(in, s)
+			}
+			out.Set(o, s, sum/area)
+			return
+		}
+		best := window[0]
+		for _, in := range window[1:] {
+			if input.At(in, s) > input.At(best, s) {
+				best = in
+			}
+		}
+		pl.argmax[s][o] = best
+		out.Set(o, s, input.At(best, s))
+	})
+	return out
+}
+
+// Backward sends each output's gradient back to the input it was the max of,
+// or spreads it evenly over the window for average pooling
+func (pl *Pool2D) Backward(dOutput *mat.Dense) *mat.Dense {
+	dInput := mat.NewDense(pl.input.Size(), pl.samples, nil)
+	area := float64(pl.size[0] * pl.size[1])
+	pl.eachWindow(func(o, s int, window []int) {
+		if pl.max {
+			in := pl.argmax[s][o]
+			dInput.Set(in, s, dInput.At(in, s)+dOutput.At(o, s))
+			return
+		}
+		for _, in := range window {
+			dInput.Set(in, s, dInput.At(in, s)+dOutput.At(o, s)/area)
+		}
+	})
+	return dInput
+}
+
+func (pl *Pool2D) Params() []*mat.Dense {
+	return nil
+}
+
+func (pl *Pool2D) Grads() []*mat.Dense {
+	return nil
+}
+
+func (pl *Pool2D) Replica() Layer {
+	return &Pool2D{max: pl.max, size: pl.size, stride: pl.stride, input: pl.input, output: pl.output}
+}
+
+// eachWindow calls fn with the row of every output of every sample and the
+// input rows in its window
+func (pl *Pool2D) eachWindow(fn func(o, s int, window []int)) {
+	ih, iw := pl.input.Height, pl.input.Width
+	oh, ow := pl.output.Height, pl.output.Width
+	window := make([]int, 0, pl.size[0]*pl.size[1])
+	for s := 0; s < pl.samples; s++ {
+		for c := 0; c < pl.input.Channels; c++ {
+			for oy := 0; oy < oh; oy++ {
+				for ox := 0; ox < ow; ox++ {
+					window = window[:0]
+					for ki := 0; ki < pl.size[0]; ki++ {
+						for kj := 0; kj < pl.size[1]; kj++ {
+							y, x := oy*pl.stride[0]+ki, ox*pl.stride[1]+kj
+							window = append(window, (c*ih+y)*iw+x)
+						}
+					}
+					fn((c*oh+oy)*ow+ox, s, window)
+				}
+			}
+		}
+	}
+}
+
+// outputSize is how many steps of a window fit along a side of an input
+func outputSize(input, window, stride, padding int) int {
+	if input+2*padding < window {
+		return 0
+	}
+	return (input+2*padding-window)/stride + 1
+}
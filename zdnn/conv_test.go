@@ -0,0 +1,82 @@
+package zdnn
+
+import (
+	"math/rand"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// checkShape builds layer for input and runs a batch of 2 through it, checking
+// both come out as want
+func checkShape(t *testing.T, name string, layer ShapedLayer, input, want Shape) {
+	t.Helper()
+	got, err := layer.BuildShape(input, rand.New(rand.NewSource(1)))
+	if err != nil {
+		t.Errorf("%s: %v", name, err)
+		return
+	}
+	if got != want {
+		t.Errorf("%s: built for %v output, want %v", name, got, want)
+	}
+	out := layer.Forward(mat.NewDense(input.Size(), 2, nil), Inference, nil)
+	if r, c := out.Dims(); r != want.Size() || c != 2 {
+		t.Errorf("%s: output is %dx%d, want %dx2", name, r, c, want.Size())
+	}
+}
+
+func TestConvOutputShape(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Conv2DConfig
+		input  Shape
+		want   Shape
+	}{
+		{"valid", Conv2DConfig{Filters: 4, Kernel: [2]int{3, 3}}, Shape{1, 5, 5}, Shape{4, 3, 3}},
+		{"same", Conv2DConfig{Filters: 4, Kernel: [2]int{3, 3}, Padding: [2]int{1, 1}}, Shape{3, 5, 5}, Shape{4, 5, 5}},
+		{"stride 2", Conv2DConfig{Filters: 2, Kernel: [2]int{3, 3}, Stride: [2]int{2, 2}}, Shape{1, 7, 7}, Shape{2, 3, 3}},
+		{"stride 2 padded", Conv2DConfig{Filters: 2, Kernel: [2]int{3, 3}, Stride: [2]int{2, 2}, Padding: [2]int{1, 1}}, Shape{1, 5, 5}, Shape{2, 3, 3}},
+		// rows left over at the edge that a stride doesn't reach are dropped
+		{"stride leaves a row", Conv2DConfig{Filters: 1, Kernel: [2]int{2, 2}, Stride: [2]int{2, 2}}, Shape{1, 5, 5}, Shape{1, 2, 2}},
+		{"uneven", Conv2DConfig{Filters: 3, Kernel: [2]int{3, 1}, Stride: [2]int{2, 1}, Padding: [2]int{0, 2}}, Shape{2, 7, 5}, Shape{3, 3, 9}},
+	}
+	for _, test := range tests {
+		conv, err := NewConv2D(test.config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkShape(t, test.name, conv, test.input, test.want)
+	}
+
+	// a kernel bigger than the padded input doesn't fit
+	conv, err := NewConv2D(Conv2DConfig{Filters: 1, Kernel: [2]int{4, 4}, Padding: [2]int{0, 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conv.BuildShape(Shape{1, 3, 3}, rand.New(rand.NewSource(1))); err == nil {
+		t.Errorf("4x4 kernel built for a 3x3 input")
+	}
+}
+
+func TestPoolOutputShape(t *testing.T) {
+	tests := []struct {
+		name   string
+		config PoolConfig
+		input  Shape
+		want   Shape
+	}{
+		{"2x2", PoolConfig{Size: [2]int{2, 2}}, Shape{3, 4, 4}, Shape{3, 2, 2}},
+		{"2x2 of odd size", PoolConfig{Size: [2]int{2, 2}}, Shape{1, 5, 5}, Shape{1, 2, 2}},
+		{"overlapping", PoolConfig{Size: [2]int{2, 2}, Stride: [2]int{1, 1}}, Shape{2, 5, 5}, Shape{2, 4, 4}},
+		{"uneven", PoolConfig{Size: [2]int{3, 2}, Stride: [2]int{1, 2}}, Shape{1, 5, 6}, Shape{1, 3, 3}},
+	}
+	for _, test := range tests {
+		for _, newPool := range []func(PoolConfig) (*Pool2D, error){NewMaxPool2D, NewAvgPool2D} {
+			pool, err := newPool(test.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkShape(t, test.name, pool, test.input, test.want)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package zdnn
+
+import (
+	"fmt"
+	"math/rand"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// DropoutLayer zeroes a fraction of its input at random while training,
+// scaling the rest up to make up for it, and passes it straight through at inference
+type DropoutLayer struct {
+	rate float64
+
+	// mask is the scaled dropout mask from the last training pass, nil when
+	// nothing was dropped
+	mask *mat.Dense
+}
+
+// NewDropout builds a layer with no weights of its own that only applies
+// dropout at rate to its input
+func NewDropout(rate float64) (*DropoutLayer, error) {
+	if rate < 0 || rate >= 1 {
+		return nil, fmt.Errorf("dropout rate %v is outside [0, 1)", rate)
+	}
+	return &DropoutLayer{rate: rate}, nil
+}
+
+// Build leaves the size unchanged
+func (dl *DropoutLayer) Build(inputSize int, rng *rand.Rand) (int, error) {
+	return inputSize, nil
+}
+
+func (dl *DropoutLayer) BuildShape(input Shape, rng *rand.Rand) (Shape, error) {
+	return input, nil
+}
+
+func (dl *DropoutLayer) Forward(input *mat.Dense, mode Mode, rng *rand.Rand) *mat.Dense {
+	dl.mask = nil
+	if mode != Training || dl.rate == 0 {
+		return input
+	}
+	dl.mask = dropoutMask(dl.rate, input, rng)
+	return Mult(input, dl.mask).(*mat.Dense)
+}
+
+// Backward only passes the gradient back to the inputs that weren't dropped
+func (dl *DropoutLayer) Backward(dOutput *mat.Dense) *mat.Dense {
+	if dl.mask == nil {
+		return dOutput
+	}
+	return Mult(dOutput, dl.mask).(*mat.Dense)
+}
+
+func (dl *DropoutLayer) Params() []*mat.Dense {
+	return nil
+}
+
+func (dl *DropoutLayer) Grads() []*mat.Dense {
+	return nil
+}
+
+func (dl *DropoutLayer) Replica() Layer {
+	return &DropoutLayer{rate: dl.rate}
+}
+
+// dropoutMask keeps each value of a matrix shaped like m with probability
+// 1 - rate, scaled by 1 / (1 - rate), and zeroes the rest
+func dropoutMask(rate float64, m mat.Matrix, rng *rand.Rand) *mat.Dense {
+	keep := 1 - rate
+	r, c := m.Dims()
+	mask := mat.NewDense(r, c, nil)
+	mask.Apply(func(_, _ int, _ float64) float64 {
+		if rng.Float64() < keep {
+			return 1 / keep
+		}
+		return 0
+	}, mask)
+	return mask
+}
@@ -0,0 +1,112 @@
+package zdnn
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// GradCheckReport breaks a gradient check down by parameter
+type GradCheckReport struct {
+	Params []ParamCheck
+}
+
+// ParamCheck is the worst disagreement found in one parameter matrix
+type ParamCheck struct {
+	Layer int
+	Name  string
+
+	// MaxRelErr is |analytic - numeric| / (|analytic| + |numeric|) at Row, Col
+	MaxRelErr float64
+	Row, Col  int
+	Analytic  float64
+	Numeric   float64
+}
+
+func (r GradCheckReport) String() string {
+	s := ""
+	for _, p := range r.Params {
+		s += fmt.Sprintf("layer %d %-7s max rel err %.3e at (%d,%d): analytic %.6e numeric %.6e\n",
+			p.Layer, p.Name, p.MaxRelErr, p.Row, p.Col, p.Analytic, p.Numeric)
+	}
+	return s
+}
+
+// GradCheck compares the gradients from backprop with central differences,
+// (L(w + eps) - L(w - eps)) / 2eps, for every param of every layer,
+// with L the mean loss over the given samples. It returns the largest relative
+// error found; under about 1e-6 means the activations and loss agree with their
+// derivatives. Don't run it on a network that is training.
+//
+// The samples go through as one batch in Training mode, so BatchNorm is checked
+// on the batch's statistics. Every evaluation draws from a source with the same
+// seed, so dropout drops the same units each time
+func GradCheck(nn *NeuralNetwork, inputs, targets [][]float64, eps float64) (float64, GradCheckReport) {
+	in := batchMatrix(inputs)
+	t := batchMatrix(targets)
+	n := float64(len(inputs))
+
+	// replicas share the params, keeping the forward state off the network
+	layers := replicas(nn.layers)
+	const seed = 1
+	meanLoss := func() float64 {
+		output := forward(layers, in, Training, rand.New(rand.NewSource(seed)))
+		return ReduceLoss(nn.lossFunc, output, t)
+	}
+
+	// backprop lists each layer's params in turn
+	var checks []ParamCheck
+	for l, layer := range nn.layers {
+		var names []string
+		if pn, ok := layer.(paramNamer); ok {
+			names = pn.paramNames()
+		}
+		for k := range layer.Params() {
+			name := fmt.Sprintf("param %d", k)
+			if k < len(names) {
+				name = names[k]
+			}
+			checks = append(checks, ParamCheck{Layer: l, Name: name})
+		}
+	}
+
+	var report GradCheckReport
+	maxErr := 0.0
+	for k, p := range nn.backprop(layers, in, t, Training, rand.New(rand.NewSource(seed))).params {
+		check := checks[k]
+
+		r, c := p.Value.Dims()
+		for i := 0; i < r; i++ {
+			for j := 0; j < c; j++ {
+				orig := p.Value.At(i, j)
+				p.Value.Set(i, j, orig+eps)
+				plus := meanLoss()
+				p.Value.Set(i, j, orig-eps)
+				minus := meanLoss()
+				p.Value.Set(i, j, orig)
+
+				numeric := (plus - minus) / (2 * eps)
+				analytic := p.Grad.At(i, j) / n
+				relErr := relativeError(analytic, numeric)
+				if relErr >= check.MaxRelErr {
+					check.MaxRelErr, check.Row, check.Col = relErr, i, j
+					check.Analytic, check.Numeric = analytic, numeric
+				}
+			}
+		}
+
+		report.Params = append(report.Params, check)
+		maxErr = math.Max(maxErr, check.MaxRelErr)
+	}
+
+	return maxErr, report
+}
+
+// relativeError that stays 0 when both values are (near) zero
+func relativeError(a, b float64) float64 {
+	denom := math.Abs(a) + math.Abs(b)
+	if denom < 1e-12 {
+		return 0
+	}
+	return math.Abs(a-b) / denom
+}
@@ -0,0 +1,192 @@
+package zdnn
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+// gradNet builds a seeded network from input through the hidden layers to output
+func gradNet(t *testing.T, input Shape, hidden []Layer, output LayerConfig, loss Loss) *NeuralNetwork {
+	t.Helper()
+	out, err := NewLayer(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nn, err := NewNetwork(NNConfig{
+		InputShape:   input,
+		HiddenLayers: hidden,
+		OutputLayer:  out,
+		LossFunc:     loss,
+		LearningRate: .1,
+		Seed:         7,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return nn
+}
+
+// denseLayers are a hidden layer of 4 units for each of acts
+func denseLayers(t *testing.T, acts ...Activation) []Layer {
+	t.Helper()
+	var layers []Layer
+	for _, act := range acts {
+		layer, err := NewLayer(LayerConfig{Neurons: 4, Activation: act})
+		if err != nil {
+			t.Fatal(err)
+		}
+		layers = append(layers, layer)
+	}
+	return layers
+}
+
+// gradSamples are 3 inputs of size values, spread over about [-1.5, 1.5]
+func gradSamples(size int) [][]float64 {
+	samples := make([][]float64, 3)
+	for i := range samples {
+		for j := 0; j < size; j++ {
+			samples[i] = append(samples[i], 1.5*math.Sin(float64(i*size+j)*1.3+.2))
+		}
+	}
+	return samples
+}
+
+var (
+	gradInputs = [][]float64{{.5, -1.2, .3}, {-.7, .1, .9}, {1.1, .4, -.6}}
+
+	// one-hot for CrossEntropy, in (0, 1) for the other losses
+	gradOneHot = [][]float64{{1, 0}, {0, 1}, {0, 1}}
+	gradProbs  = [][]float64{{.2, .9}, {.7, .4}, {.5, .1}}
+)
+
+const gradTolerance = 1e-6
+
+func checkGrads(t *testing.T, nn *NeuralNetwork, inputs, targets [][]float64) {
+	t.Helper()
+	maxErr, report := GradCheck(nn, inputs, targets, 1e-5)
+	if maxErr >= gradTolerance {
+		t.Errorf("max relative error %.3e, want under %.0e\n%v", maxErr, gradTolerance, report)
+	}
+}
+
+func TestGradCheckActivations(t *testing.T) {
+	for act := Sigmoid; act <= Linear; act++ {
+		t.Run(act.String(), func(t *testing.T) {
+			nn := gradNet(t, flat(3), denseLayers(t, act), LayerConfig{Neurons: 2, Activation: Linear}, MeanSquared)
+			checkGrads(t, nn, gradInputs, gradProbs)
+		})
+	}
+}
+
+func TestGradCheckLosses(t *testing.T) {
+	tests := []struct {
+		loss    Loss
+		output  Activation
+		targets [][]float64
+	}{
+		{CrossEntropy, Softmax, gradOneHot},
+		{MeanSquared, Linear, gradProbs},
+		{MeanSquared, Sigmoid, gradProbs},
+		{BinaryCrossEntropy, Sigmoid, gradProbs},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%v/%v", test.loss, test.output), func(t *testing.T) {
+			nn := gradNet(t, flat(3), denseLayers(t, Tanh), LayerConfig{Neurons: 2, Activation: test.output}, test.loss)
+			checkGrads(t, nn, gradInputs, test.targets)
+		})
+	}
+}
+
+func TestGradCheckDepth(t *testing.T) {
+	for _, hidden := range [][]Activation{nil, {Tanh}, {Tanh, Sigmoid, ELU}} {
+		t.Run(fmt.Sprintf("%d hidden", len(hidden)), func(t *testing.T) {
+			nn := gradNet(t, flat(3), denseLayers(t, hidden...), LayerConfig{Neurons: 2, Activation: Softmax}, CrossEntropy)
+			checkGrads(t, nn, gradInputs, gradOneHot)
+		})
+	}
+}
+
+// TestGradCheckTrainingLayers checks the layers that behave differently while
+// training: BatchNorm on the batch's statistics, and dropout
+func TestGradCheckTrainingLayers(t *testing.T) {
+	build := map[string]func() (Layer, error){
+		"batch norm": func() (Layer, error) { return NewBatchNorm(DefaultNormConfig()) },
+		"layer norm": func() (Layer, error) { return NewLayerNorm(DefaultNormConfig()) },
+		"dropout":    func() (Layer, error) { return NewDropout(.3) },
+	}
+	for name, newLayer := range build {
+		t.Run(name, func(t *testing.T) {
+			layer, err := newLayer()
+			if err != nil {
+				t.Fatal(err)
+			}
+			nn := gradNet(t, flat(3), append(denseLayers(t, Tanh), layer), LayerConfig{Neurons: 2, Activation: Softmax}, CrossEntropy)
+			checkGrads(t, nn, gradInputs, gradOneHot)
+		})
+	}
+}
+
+func TestGradCheckRecurrent(t *testing.T) {
+	build := map[string]func(RNNConfig) (*Recurrent, error){"simple rnn": NewSimpleRNN, "lstm": NewLSTM, "gru": NewGRU}
+	for name, newRecurrent := range build {
+		for _, sequences := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/return sequences %v", name, sequences), func(t *testing.T) {
+				layer, err := newRecurrent(RNNConfig{Units: 3, ReturnSequences: sequences})
+				if err != nil {
+					t.Fatal(err)
+				}
+				input := SequenceShape(4, 2)
+				nn := gradNet(t, input, []Layer{layer}, LayerConfig{Neurons: 2, Activation: Softmax}, CrossEntropy)
+				checkGrads(t, nn, gradSamples(input.Size()), gradOneHot)
+			})
+		}
+	}
+}
+
+func TestGradCheckConv(t *testing.T) {
+	conv := func(config Conv2DConfig) func() (Layer, error) {
+		return func() (Layer, error) { return NewConv2D(config) }
+	}
+	pool := func(max bool, config PoolConfig) func() (Layer, error) {
+		return func() (Layer, error) {
+			if max {
+				return NewMaxPool2D(config)
+			}
+			return NewAvgPool2D(config)
+		}
+	}
+	tests := []struct {
+		name   string
+		layers []func() (Layer, error)
+	}{
+		{"conv", []func() (Layer, error){conv(Conv2DConfig{Filters: 2, Kernel: [2]int{3, 3}})}},
+		{"conv with stride and padding", []func() (Layer, error){conv(Conv2DConfig{Filters: 2, Kernel: [2]int{3, 3}, Stride: [2]int{2, 2}, Padding: [2]int{1, 1}})}},
+		{"conv with uneven kernel, stride and padding", []func() (Layer, error){conv(Conv2DConfig{Filters: 3, Kernel: [2]int{2, 3}, Stride: [2]int{1, 2}, Padding: [2]int{2, 1}})}},
+		{"max pool", []func() (Layer, error){conv(Conv2DConfig{Filters: 2, Kernel: [2]int{2, 2}}), pool(true, PoolConfig{Size: [2]int{2, 2}})}},
+		{"overlapping max pool", []func() (Layer, error){conv(Conv2DConfig{Filters: 2, Kernel: [2]int{2, 2}}), pool(true, PoolConfig{Size: [2]int{2, 2}, Stride: [2]int{1, 1}})}},
+		{"avg pool", []func() (Layer, error){conv(Conv2DConfig{Filters: 2, Kernel: [2]int{2, 2}}), pool(false, PoolConfig{Size: [2]int{2, 2}})}},
+		{"overlapping avg pool", []func() (Layer, error){conv(Conv2DConfig{Filters: 2, Kernel: [2]int{2, 2}}), pool(false, PoolConfig{Size: [2]int{3, 2}, Stride: [2]int{1, 2}})}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var hidden []Layer
+			for _, build := range test.layers {
+				layer, err := build()
+				if err != nil {
+					t.Fatal(err)
+				}
+				hidden = append(hidden, layer)
+			}
+			act, err := NewActivationLayer("tanh")
+			if err != nil {
+				t.Fatal(err)
+			}
+			hidden = append(hidden, act)
+
+			input := Shape{Channels: 2, Height: 5, Width: 5}
+			nn := gradNet(t, input, hidden, LayerConfig{Neurons: 2, Activation: Softmax}, CrossEntropy)
+			checkGrads(t, nn, gradSamples(input.Size()), gradOneHot)
+		})
+	}
+}
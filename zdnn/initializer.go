@@ -0,0 +1,130 @@
+package zdnn
+
+import (
+	"math"
+	"math/rand"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Initializer fills a layer's new weight (or bias) matrix. fanIn and fanOut
+// are the sizes of the layer's input and output, and rng is the network's own
+// random source so seeded networks start the same every time
+type Initializer interface {
+	Init(m *mat.Dense, fanIn, fanOut int, rng *rand.Rand)
+}
+
+// InitializerFunc lets a plain function be used as an Initializer
+type InitializerFunc func(m *mat.Dense, fanIn, fanOut int, rng *rand.Rand)
+
+func (f InitializerFunc) Init(m *mat.Dense, fanIn, fanOut int, rng *rand.Rand) {
+	f(m, fanIn, fanOut, rng)
+}
+
+// GlorotUniform (Xavier) draws from +-sqrt(6 / (fanIn + fanOut)), suiting sigmoid and tanh layers
+type GlorotUniform struct{}
+
+// GlorotNormal (Xavier) draws from N(0, 2 / (fanIn + fanOut))
+type GlorotNormal struct{}
+
+// HeUniform (Kaiming) draws from +-sqrt(6 / fanIn), suiting ReLU layers
+type HeUniform struct{}
+
+// HeNormal (Kaiming) draws from N(0, 2 / fanIn)
+type HeNormal struct{}
+
+// LeCunUniform draws from +-sqrt(3 / fanIn), suiting SELU layers
+type LeCunUniform struct{}
+
+// LeCunNormal draws from N(0, 1 / fanIn)
+type LeCunNormal struct{}
+
+// Orthogonal fills the matrix with orthonormal rows (or columns, whichever
+// there are fewer of), scaled by Gain (default 1)
+type Orthogonal struct {
+	Gain float64
+}
+
+// Constant sets every value to Value
+type Constant struct {
+	Value float64
+}
+
+func (GlorotUniform) Init(m *mat.Dense, fanIn, fanOut int, rng *rand.Rand) {
+	fillUniform(m, math.Sqrt(6/float64(fanIn+fanOut)), rng)
+}
+
+func (GlorotNormal) Init(m *mat.Dense, fanIn, fanOut int, rng *rand.Rand) {
+	fillNormal(m, math.Sqrt(2/float64(fanIn+fanOut)), rng)
+}
+
+func (HeUniform) Init(m *mat.Dense, fanIn, fanOut int, rng *rand.Rand) {
+	fillUniform(m, math.Sqrt(6/float64(fanIn)), rng)
+}
+
+func (HeNormal) Init(m *mat.Dense, fanIn, fanOut int, rng *rand.Rand) {
+	fillNormal(m, math.Sqrt(2/float64(fanIn)), rng)
+}
+
+func (LeCunUniform) Init(m *mat.Dense, fanIn, fanOut int, rng *rand.Rand) {
+	fillUniform(m, math.Sqrt(3/float64(fanIn)), rng)
+}
+
+func (LeCunNormal) Init(m *mat.Dense, fanIn, fanOut int, rng *rand.Rand) {
+	fillNormal(m, math.Sqrt(1/float64(fanIn)), rng)
+}
+
+func (o Orthogonal) Init(m *mat.Dense, fanIn, fanOut int, rng *rand.Rand) {
+	r, c := m.Dims()
+
+	// QR needs a tall matrix, so work on the transpose of a wide one
+	rows, cols := r, c
+	if r < c {
+		rows, cols = c, r
+	}
+	a := mat.NewDense(rows, cols, nil)
+	fillNormal(a, 1, rng)
+
+	var qr mat.QR
+	qr.Factorize(a)
+	var q, rMat mat.Dense
+	qr.QTo(&q)
+	qr.RTo(&rMat)
+
+	// flip columns by the sign of R's diagonal so Q is uniformly distributed
+	gain := orDefault(o.Gain, 1)
+	for j := 0; j < cols; j++ {
+		sign := 1.0
+		if rMat.At(j, j) < 0 {
+			sign = -1.0
+		}
+		for i := 0; i < rows; i++ {
+			v := gain * sign * q.At(i, j)
+			if r < c {
+				m.Set(j, i, v)
+			} else {
+				m.Set(i, j, v)
+			}
+		}
+	}
+}
+
+func (k Constant) Init(m *mat.Dense, fanIn, fanOut int, rng *rand.Rand) {
+	m.Apply(func(_, _ int, _ float64) float64 { return k.Value }, m)
+}
+
+// fanInUniform is the original init, uniform in +-1/sqrt(fanIn), used when a layer doesn't pick one
+type fanInUniform struct{}
+
+func (fanInUniform) Init(m *mat.Dense, fanIn, fanOut int, rng *rand.Rand) {
+	r, c := m.Dims()
+	m.Copy(mat.NewDense(r, c, randomArray(rng, r*c, float64(fanIn))))
+}
+
+func fillUniform(m *mat.Dense, limit float64, rng *rand.Rand) {
+	m.Apply(func(_, _ int, _ float64) float64 { return (rng.Float64()*2 - 1) * limit }, m)
+}
+
+func fillNormal(m *mat.Dense, stddev float64, rng *rand.Rand) {
+	m.Apply(func(_, _ int, _ float64) float64 { return rng.NormFloat64() * stddev }, m)
+}
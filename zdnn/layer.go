@@ -1,30 +1,150 @@
 package zdnn
 
 import (
-	// "fmt"
+	"fmt"
+	"math/rand"
+
 	"gonum.org/v1/gonum/mat"
 )
 
-// NeuronLayer is a general purpose layer struct
+// Layer is one step of a network. Data flows through as matrices with one row
+// per value and one column per sample. A network calls Build once, then for
+// each batch Forward through every layer and Backward through them in reverse,
+// before handing Params and Grads to the optimizer
+type Layer interface {
+	// Build sizes the layer for inputs of inputSize values, initializing its
+	// params from rng, and returns the size of its output
+	Build(inputSize int, rng *rand.Rand) (int, error)
+
+	// Forward runs input through the layer, keeping whatever Backward will
+	// need. Stochastic layers draw from rng in Training mode; in Inference
+	// mode rng may be nil
+	Forward(input *mat.Dense, mode Mode, rng *rand.Rand) *mat.Dense
+
+	// Backward takes the gradient of the loss with respect to the output of
+	// the last Forward and returns it with respect to that Forward's input,
+	// keeping the gradients of the params for Grads
+	Backward(dOutput *mat.Dense) *mat.Dense
+
+	// Params are the layer's trainable matrices, which the optimizer updates in place
+	Params() []*mat.Dense
+
+	// Grads are the gradients of Params from the last Backward, summed over the samples
+	Grads() []*mat.Dense
+
+	// Replica is a copy of the layer sharing its params (and any other state
+	// kept between batches) but with its own forward and backward state, so
+	// workers can run the same layer side by side
+	Replica() Layer
+}
+
+// WeightedLayer is a Layer with weights among its params. Only weights are
+// decayed by AdamW or get the Weights penalty of a Regularization; its other
+// params get the Bias penalty. Params of layers that aren't WeightedLayers,
+// like the gamma and beta of a norm layer, are left alone
+type WeightedLayer interface {
+	Layer
+
+	// IsWeight reports whether Params()[k] is a weight rather than a bias
+	IsWeight(k int) bool
+
+	// Regularization, if not nil, replaces the network's for this layer
+	Regularization() *Regularization
+}
+
+// NeuronLayer is a general purpose dense layer: weights, bias and an activation
 type NeuronLayer struct {
 	config LayerConfig
 
 	activation IActivation
 	weights    *mat.Dense
 	bias       *mat.Dense
-	output     *mat.Dense
+
+	// kept from the forward pass for backprop: the layer's input, its
+	// weighted input z = W.input + b and the activated output
+	input  *mat.Dense
+	z      *mat.Dense
+	output *mat.Dense
+
+	// mask is the scaled dropout mask from the last training pass, nil when
+	// nothing was dropped
+	mask *mat.Dense
+
+	// from the last backward pass
+	grads []*mat.Dense
 }
 
 // LayerConfig is the configuration for a NN Layer
 type LayerConfig struct {
 	Neurons    int
 	Activation Activation
+
+	// ActivationName, if set, picks a registered activation (see
+	// RegisterActivation) instead of the built in Activation
+	ActivationName string
+
+	// Initializer and BiasInitializer set the starting weights and bias. Left
+	// nil, both are uniform in +-1/sqrt(fan in)
+	Initializer     Initializer
+	BiasInitializer Initializer
+
+	// Regularization, if set, replaces the network's for this layer
+	Regularization *Regularization
+
+	// Dropout is the fraction of the layer's outputs zeroed at random while
+	// training, in [0, 1). The rest are scaled up by 1 / (1 - Dropout) so
+	// nothing needs rescaling at inference, when no outputs are dropped
+	Dropout float64
 }
 
 // NewLayer builds a new general purpose layer from a config object
-func NewLayer(config LayerConfig) *NeuronLayer {
-	act := NewActivation(config.Activation)
-	return &NeuronLayer{config: config, activation: act}
+func NewLayer(config LayerConfig) (*NeuronLayer, error) {
+	var act IActivation
+	var err error
+	if config.ActivationName != "" {
+		act, err = ActivationByName(config.ActivationName)
+	} else {
+		act, err = NewActivation(config.Activation)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if config.Dropout < 0 || config.Dropout >= 1 {
+		return nil, fmt.Errorf("dropout rate %v is outside [0, 1)", config.Dropout)
+	}
+	return &NeuronLayer{config: config, activation: act}, nil
+}
+
+// activationName is the registry name the layer's activation can be rebuilt from
+func (nl *NeuronLayer) activationName() string {
+	if nl.config.ActivationName != "" {
+		return nl.config.ActivationName
+	}
+	return nl.config.Activation.String()
+}
+
+// Build creates the layer's weights and bias for an input of size fanIn
+func (nl *NeuronLayer) Build(fanIn int, rng *rand.Rand) (int, error) {
+	fanOut := nl.config.Neurons
+	if fanOut < 1 {
+		return 0, fmt.Errorf("layer has %d neurons", fanOut)
+	}
+
+	nl.weights = mat.NewDense(fanOut, fanIn, nil)
+	weightInit := nl.config.Initializer
+	if weightInit == nil {
+		weightInit = fanInUniform{}
+	}
+	weightInit.Init(nl.weights, fanIn, fanOut, rng)
+
+	nl.bias = mat.NewDense(fanOut, 1, nil)
+	biasInit := nl.config.BiasInitializer
+	if biasInit == nil {
+		biasInit = fanInUniform{}
+	}
+	biasInit.Init(nl.bias, fanIn, fanOut, rng)
+
+	return fanOut, nil
 }
 
 // Update the weights and bias
@@ -32,3 +152,186 @@ func (nl *NeuronLayer) Update(weights, bias *mat.Dense) {
 	nl.weights = weights
 	nl.bias = bias
 }
+
+// Replica shares the layer's config, activation, weights and bias but keeps its
+// own forward state, so workers can run the same layer side by side
+func (nl *NeuronLayer) Replica() Layer {
+	return &NeuronLayer{config: nl.config, activation: nl.activation, weights: nl.weights, bias: nl.bias}
+}
+
+// Params are the layer's trainable matrices: weights, bias, then any the activation has
+func (nl *NeuronLayer) Params() []*mat.Dense {
+	params := []*mat.Dense{nl.weights, nl.bias}
+	if pa, ok := nl.activation.(ParamActivation); ok {
+		params = append(params, pa.Params()...)
+	}
+	return params
+}
+
+func (nl *NeuronLayer) Grads() []*mat.Dense {
+	return nl.grads
+}
+
+// IsWeight is only true of the weights themselves
+func (nl *NeuronLayer) IsWeight(k int) bool {
+	return k == 0
+}
+
+func (nl *NeuronLayer) Regularization() *Regularization {
+	return nl.config.Regularization
+}
+
+func (nl *NeuronLayer) paramNames() []string {
+	names := []string{"weights", "bias"}
+	for range nl.Params()[2:] {
+		names = append(names, "activation")
+	}
+	return names
+}
+
+// Forward runs input through the layer, keeping what Backward needs. In
+// Training mode dropout draws a new mask from rng
+func (nl *NeuronLayer) Forward(input *mat.Dense, mode Mode, rng *rand.Rand) *mat.Dense {
+	nl.input = input
+	nl.z = AddBias(Dot(nl.weights, input), nl.bias).(*mat.Dense)
+	nl.output = nl.activation.Apply(nl.z).(*mat.Dense)
+
+	nl.mask = nil
+	if mode != Training || nl.config.Dropout == 0 {
+		return nl.output
+	}
+	nl.mask = dropoutMask(nl.config.Dropout, nl.output, rng)
+	return Mult(nl.output, nl.mask).(*mat.Dense)
+}
+
+// Backward takes the gradient of the loss with respect to the layer's output
+// from the last forward pass, and returns it with respect to the layer's input
+func (nl *NeuronLayer) Backward(dOutput *mat.Dense) *mat.Dense {
+	// dropped outputs didn't reach the loss, so get no gradient
+	if nl.mask != nil {
+		dOutput = Mult(dOutput, nl.mask).(*mat.Dense)
+	}
+	delta := backpropActivation(nl.activation, nl.z, nl.output, dOutput)
+	return nl.backwardDelta(delta, dOutput)
+}
+
+// backwardDelta is Backward from delta, the gradient with respect to the
+// layer's weighted input z. dOutput is only needed by activations with params
+func (nl *NeuronLayer) backwardDelta(delta *mat.Dense, dOutput mat.Matrix) *mat.Dense {
+	nl.grads = []*mat.Dense{Dot(delta, nl.input.T()).(*mat.Dense), sumAlongAxis(1, delta)}
+	if pa, ok := nl.activation.(ParamActivation); ok {
+		nl.grads = append(nl.grads, pa.ParamGrads(nl.z, dOutput)...)
+	}
+	return Dot(nl.weights.T(), delta).(*mat.Dense)
+}
+
+// outputActivation is the activation a loss can be fused with, as long as no
+// dropout comes after it
+func (nl *NeuronLayer) outputActivation() IActivation {
+	if nl.config.Dropout != 0 {
+		return nil
+	}
+	return nl.activation
+}
+
+// ActivationLayer applies an activation on its own, leaving the size of its input unchanged
+type ActivationLayer struct {
+	name       string
+	activation IActivation
+
+	// kept from the forward pass for backprop
+	input  *mat.Dense
+	output *mat.Dense
+
+	// from the last backward pass, for activations with params
+	grads []*mat.Dense
+}
+
+// NewActivationLayer builds a layer applying the activation registered as
+// name, which is Activation.String() for the built in ones
+func NewActivationLayer(name string) (*ActivationLayer, error) {
+	act, err := ActivationByName(name)
+	if err != nil {
+		return nil, err
+	}
+	return &ActivationLayer{name: name, activation: act}, nil
+}
+
+func (al *ActivationLayer) Build(inputSize int, rng *rand.Rand) (int, error) {
+	return inputSize, nil
+}
+
+// BuildShape leaves the shape unchanged, so an activation can follow a convolution
+func (al *ActivationLayer) BuildShape(input Shape, rng *rand.Rand) (Shape, error) {
+	return input, nil
+}
+
+func (al *ActivationLayer) Forward(input *mat.Dense, mode Mode, rng *rand.Rand) *mat.Dense {
+	al.input = input
+	al.output = al.activation.Apply(input).(*mat.Dense)
+	return al.output
+}
+
+func (al *ActivationLayer) Backward(dOutput *mat.Dense) *mat.Dense {
+	delta := backpropActivation(al.activation, al.input, al.output, dOutput)
+	return al.backwardDelta(delta, dOutput)
+}
+
+func (al *ActivationLayer) backwardDelta(delta *mat.Dense, dOutput mat.Matrix) *mat.Dense {
+	al.grads = nil
+	if pa, ok := al.activation.(ParamActivation); ok {
+		al.grads = pa.ParamGrads(al.input, dOutput)
+	}
+	return delta
+}
+
+func (al *ActivationLayer) outputActivation() IActivation {
+	return al.activation
+}
+
+// Params are any the activation has, like PReLU's slope
+func (al *ActivationLayer) Params() []*mat.Dense {
+	if pa, ok := al.activation.(ParamActivation); ok {
+		return pa.Params()
+	}
+	return nil
+}
+
+func (al *ActivationLayer) Grads() []*mat.Dense {
+	return al.grads
+}
+
+func (al *ActivationLayer) paramNames() []string {
+	names := make([]string, len(al.Params()))
+	for k := range names {
+		names[k] = "activation"
+	}
+	return names
+}
+
+func (al *ActivationLayer) Replica() Layer {
+	return &ActivationLayer{name: al.name, activation: al.activation}
+}
+
+// fusedLayer is a layer ending in an activation, which backprop can skip
+// straight past when the loss gives the gradient with respect to its input
+type fusedLayer interface {
+	// outputActivation is the activation, or nil if something comes after it
+	outputActivation() IActivation
+
+	// backwardDelta is Backward given delta, the gradient with respect to the
+	// activation's input. dOutput may be nil if the activation has no params
+	backwardDelta(delta *mat.Dense, dOutput mat.Matrix) *mat.Dense
+}
+
+// statsLayer is a layer keeping statistics of what it sees while training,
+// like BatchNorm's running mean. After each batch mergeStats is given the
+// replicas that ran each worker's shard of it (the layer itself among them)
+type statsLayer interface {
+	mergeStats(replicas []Layer)
+}
+
+// paramNamer is implemented by the built in layers to label their params in a GradCheckReport
+type paramNamer interface {
+	paramNames() []string
+}
@@ -1,8 +1,10 @@
 package zdnn
 
 import (
+	"fmt"
+	"math"
+
 	"gonum.org/v1/gonum/mat"
-	// "fmt"
 )
 
 type Loss int
@@ -10,46 +12,91 @@ type Loss int
 const (
 	CrossEntropy Loss = iota
 	MeanSquared
+	BinaryCrossEntropy
 )
 
+// logs are clamped to [epsilon, 1 - epsilon] so a confident wrong guess can't blow up to inf
+const epsilon = 1e-12
+
+// ILoss is an element-wise loss. Apply gives the loss of every output and
+// ApplyPrime its derivative with respect to the outputs m, given targets t
 type ILoss interface {
 	Apply(m, t mat.Matrix) mat.Matrix
 	ApplyPrime(m, t mat.Matrix) mat.Matrix
 }
 
+// CE is categorical cross entropy, for one-hot targets over a softmax output
 type CE struct{}
+
+// BCE is binary cross entropy, for independent 0/1 targets over sigmoid outputs
+type BCE struct{}
+
+// MS is half the squared error, so its derivative is simply m - t
 type MS struct{}
 
-func NewLoss(opt Loss) ILoss {
+// NewLoss builds the loss for opt, or errors if there isn't one
+func NewLoss(opt Loss) (ILoss, error) {
 	switch opt {
 	case CrossEntropy:
-		return CE{}
+		return CE{}, nil
 	case MeanSquared:
-		return MS{}
+		return MS{}, nil
+	case BinaryCrossEntropy:
+		return BCE{}, nil
 	}
-	return nil
+	return nil, fmt.Errorf("unknown loss %d", opt)
 }
 
+// ReduceLoss sums the loss down each column and averages across the columns,
+// giving the mean loss per sample
+func ReduceLoss(l ILoss, m, t mat.Matrix) float64 {
+	_, c := m.Dims()
+	return mat.Sum(l.Apply(m, t)) / float64(c)
+}
+
+// -t * log(m)
 func (l CE) Apply(m, t mat.Matrix) mat.Matrix {
-	applyFn := func(_, _ int, val float64) float64 { return val * val }
-	return Apply(applyFn, Subtract(t, m))
+	applyFn := func(i, j int, val float64) float64 { return -val * math.Log(clamp(m.At(i, j))) }
+	return Apply(applyFn, t)
 }
 
+// -t / m
 func (l CE) ApplyPrime(m, t mat.Matrix) mat.Matrix {
+	applyFn := func(i, j int, val float64) float64 { return -val / clamp(m.At(i, j)) }
+	return Apply(applyFn, t)
+}
 
-	dLoss := (Subtract(t, m)).(*mat.Dense)
+// -(t * log(m) + (1 - t) * log(1 - m))
+func (l BCE) Apply(m, t mat.Matrix) mat.Matrix {
+	applyFn := func(i, j int, val float64) float64 {
+		p := clamp(m.At(i, j))
+		return -(val*math.Log(p) + (1.0-val)*math.Log(1.0-p))
+	}
+	return Apply(applyFn, t)
+}
 
-	return dLoss
+// (m - t) / (m * (1 - m))
+func (l BCE) ApplyPrime(m, t mat.Matrix) mat.Matrix {
+	applyFn := func(i, j int, val float64) float64 {
+		p := clamp(m.At(i, j))
+		return (p - val) / (p * (1.0 - p))
+	}
+	return Apply(applyFn, t)
 }
 
 func (l MS) Apply(m, t mat.Matrix) mat.Matrix {
-	applyFn := func(_, _ int, val float64) float64 { return val * val }
-	return Apply(applyFn, Subtract(t, m))
+	applyFn := func(_, _ int, val float64) float64 { return 0.5 * val * val }
+	return Apply(applyFn, Subtract(m, t))
 }
 
 func (l MS) ApplyPrime(m, t mat.Matrix) mat.Matrix {
 
-	dLoss := (Subtract(t, m)).(*mat.Dense)
+	dLoss := (Subtract(m, t)).(*mat.Dense)
 
 	return dLoss
 }
+
+// clamp a probability away from 0 and 1 before taking logs of it
+func clamp(p float64) float64 {
+	return math.Min(math.Max(p, epsilon), 1.0-epsilon)
+}
@@ -2,10 +2,10 @@ package zdnn
 
 import (
 	"math"
+	"math/rand"
 
 	"gonum.org/v1/gonum/floats"
 	"gonum.org/v1/gonum/mat"
-	"gonum.org/v1/gonum/stat/distuv"
 )
 
 // matrix helpers from https://sausheong.github.io/posts/how-to-build-a-simple-artificial-neural-network-with-go/
@@ -54,6 +54,14 @@ func Add(m, n mat.Matrix) mat.Matrix {
 	return o
 }
 
+// AddBias adds the column vector b to every column of m
+func AddBias(m, b mat.Matrix) mat.Matrix {
+	r, c := m.Dims()
+	o := mat.NewDense(r, c, nil)
+	o.Apply(func(i, _ int, val float64) float64 { return val + b.At(i, 0) }, m)
+	return o
+}
+
 func Subtract(m, n mat.Matrix) mat.Matrix {
 	r, c := m.Dims()
 	o := mat.NewDense(r, c, nil)
@@ -71,6 +79,14 @@ func AddScalar(i float64, m mat.Matrix) mat.Matrix {
 	return Add(m, n)
 }
 
+// dense gives m as a *mat.Dense, copying it only if it isn't one already
+func dense(m mat.Matrix) *mat.Dense {
+	if d, ok := m.(*mat.Dense); ok {
+		return d
+	}
+	return mat.DenseCopyOf(m)
+}
+
 // sumAlongAxis sums a matrix along a particular dimension,
 // preserving the other dimension.
 func sumAlongAxis(axis int, m *mat.Dense) *mat.Dense {
@@ -101,16 +117,22 @@ func sumAlongAxis(axis int, m *mat.Dense) *mat.Dense {
 	return output
 }
 
-// generate random array of start weights
-func randomArray(size int, v float64) (data []float64) {
-	dist := distuv.Uniform{
-		Min: -1 / math.Sqrt(v),
-		Max: 1 / math.Sqrt(v),
+// batchMatrix stacks the samples as the columns of one matrix
+func batchMatrix(samples [][]float64) *mat.Dense {
+	m := mat.NewDense(len(samples[0]), len(samples), nil)
+	for j, sample := range samples {
+		m.SetCol(j, sample)
 	}
+	return m
+}
+
+// generate random array of start weights, uniform in +-1/sqrt(v)
+func randomArray(rng *rand.Rand, size int, v float64) (data []float64) {
+	limit := 1 / math.Sqrt(v)
 
 	data = make([]float64, size)
 	for i := 0; i < size; i++ {
-		data[i] = dist.Rand()
+		data[i] = (rng.Float64()*2 - 1) * limit
 	}
 	return
 }
@@ -11,7 +11,7 @@ import (
 	// "os"
 	"sync"
 
-	"github.com/sethgrid/multibar"
+	"github.com/zaviermiller/zml/utils"
 	"gonum.org/v1/gonum/mat"
 )
 
@@ -19,171 +19,420 @@ import (
 type NeuralNetwork struct {
 	// configuration and other setup for net
 	config NNConfig
-	mu     sync.Mutex
+	mu     sync.RWMutex
 
 	// layers and loss func
-	layers   []*NeuronLayer
+	layers   []Layer
 	lossFunc ILoss
+
+	// applies the gradients from each batch
+	optimizer Optimizer
+
+	// where training is up to, for the scheduler
+	epoch int
+	step  int
+
+	// held out data to report (and schedule on) each epoch
+	validInputs   [][]float64
+	validExpected [][]float64
+
+	// loss recorded while training
+	history History
+
+	// drives weight init and shuffling, seeded from the config
+	rng *rand.Rand
+}
+
+// Mode tells layers whether the network is training or only predicting, so
+// stochastic ones (like dropout) only act while training
+type Mode int
+
+const (
+	Inference Mode = iota
+	Training
+)
+
+// History is the mean loss per sample of every batch and epoch trained so far,
+// plus the loss on the validation set after each epoch if one was given
+type History struct {
+	BatchLoss      []float64
+	EpochLoss      []float64
+	ValidationLoss []float64
 }
 
 // NNConfig is simple configuration params for the network
 type NNConfig struct {
 	InputNeurons int
-	HiddenLayers []*NeuronLayer
-	OutputLayer  *NeuronLayer
+
+	// InputShape, if set, is the layout of image-like inputs for the
+	// ShapedLayers (like Conv2D) to use. InputNeurons can then be left 0
+	InputShape Shape
+
+	HiddenLayers []Layer
+	OutputLayer  Layer
 	NumEpochs    int
 	LearningRate float64
 	LossFunc     Loss
 	BatchSize    int
+
+	// LossName, if set, picks a registered loss (see RegisterLoss) instead of
+	// the built in LossFunc
+	LossName string
+
+	// Optimizer applies each batch's gradients, plain SGD if nil
+	Optimizer Optimizer
+
+	// Scheduler adjusts LearningRate as training goes, constant if nil
+	Scheduler Scheduler
+
+	// Regularization penalizes large weights and biases in every layer that
+	// doesn't set its own
+	Regularization Regularization
+
+	// Workers is how many goroutines share the forward and backward pass of
+	// each batch (default 1)
+	Workers int
+
+	// Prefetch is how many batches Train reads from its data set ahead of the
+	// one being trained on, each on its own goroutine. With 0 each batch is
+	// read when it's needed
+	Prefetch int
+
+	// Progress, if set, is called after every batch Train or TrainLoader
+	// trains on. Otherwise they draw a progress bar per epoch when run in a
+	// terminal, and report nothing when not
+	Progress ProgressFunc
+
+	// Seed makes weight init and shuffling reproducible, and 0 is a seed like
+	// any other: two networks built from the same config start out the same.
+	// Source, if set, is used instead. Set RandomSeed to seed from the clock,
+	// for a different network every run
+	Seed       int64
+	Source     rand.Source
+	RandomSeed bool
 }
 
 // NewNetwork builds the network using a passed config
-func NewNetwork(config NNConfig) *NeuralNetwork {
-
-	// get the loss function from loss type
-	loss := NewLoss(config.LossFunc)
+func NewNetwork(config NNConfig) (*NeuralNetwork, error) {
+
+	// get the loss function from loss type (or name)
+	var loss ILoss
+	var err error
+	if config.LossName != "" {
+		loss, err = LossByName(config.LossName)
+	} else {
+		loss, err = NewLoss(config.LossFunc)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if config.OutputLayer == nil {
+		return nil, fmt.Errorf("network has no output layer")
+	}
 
 	// init network struct
-	nn := &NeuralNetwork{config: config, layers: append(append([]*NeuronLayer{}, config.HiddenLayers...), config.OutputLayer), lossFunc: loss} // lmao
+	nn := &NeuralNetwork{config: config, layers: append(append([]Layer{}, config.HiddenLayers...), config.OutputLayer), lossFunc: loss} // lmao
+	nn.rng = newRand(config)
 
-	prevSize := nn.config.InputNeurons
+	nn.optimizer = config.Optimizer
+	if nn.optimizer == nil {
+		nn.optimizer = &SGD{}
+	}
+	if err := validate(nn.optimizer); err != nil {
+		return nil, err
+	}
+	if err := validate(config.Scheduler); err != nil {
+		return nil, err
+	}
 
-	// randomly init layer w&b
-	for _, layer := range nn.layers {
-		layer.weights = mat.NewDense(layer.config.Neurons, prevSize, randomArray(prevSize*layer.config.Neurons, float64(prevSize)))
-		layer.bias = mat.NewDense(layer.config.Neurons, 1, randomArray(layer.config.Neurons, float64(layer.config.Neurons)))
-		prevSize = layer.config.Neurons
+	shape := flat(nn.config.InputNeurons)
+	if nn.config.InputShape != (Shape{}) {
+		shape = nn.config.InputShape
+		if nn.config.InputNeurons == 0 {
+			nn.config.InputNeurons = shape.Size()
+		}
+		if nn.config.InputNeurons != shape.Size() {
+			return nil, fmt.Errorf("%d input neurons don't fit input shape %v", nn.config.InputNeurons, shape)
+		}
+	}
+
+	// randomly init layer w&b, passing each layer's output shape to the next
+	for i, layer := range nn.layers {
+		shape, err = buildLayer(layer, shape, nn.rng)
+		if err != nil {
+			return nil, fmt.Errorf("layer %d: %v", i, err)
+		}
 	}
 
-	return nn
+	return nn, nil
 }
 
-// Train the network [nn.config.NumEpochs] times (fully train the network)
-func (nn *NeuralNetwork) Train(inputArr, expected [][]float64, setSize int) {
-	var wg sync.WaitGroup
+// lossName is the registry name the network's loss can be rebuilt from
+func (nn *NeuralNetwork) lossName() string {
+	if nn.config.LossName != "" {
+		return nn.config.LossName
+	}
+	return nn.config.LossFunc.String()
+}
 
-	// create the multibar container
-	// this allows our bars to work together without stomping on one another
-	progressBars, _ := multibar.New()
+// Train the network [nn.config.NumEpochs] times (fully train the network) on
+// data, in batches of [nn.config.BatchSize] shuffled from the network's seed.
+// Any samples left over from the last full batch of an epoch are skipped
+func (nn *NeuralNetwork) Train(data utils.Dataset) error {
+	var seed int64
+	nn.syncUpdate(func() {
+		seed = nn.rng.Int63()
+	})
+	loader, err := utils.NewDataLoader(data, utils.LoaderConfig{
+		BatchSize: nn.config.BatchSize,
+		Shuffle:   true,
+		Seed:      seed,
+		DropLast:  true,
+		Prefetch:  nn.config.Prefetch,
+	})
+	if err != nil {
+		return err
+	}
+	return nn.TrainLoader(loader)
+}
 
-	for e := 0; e < nn.config.NumEpochs; e++ {
-		var batchNum int = setSize / nn.config.BatchSize
+// TrainLoader trains the network [nn.config.NumEpochs] times over the batches
+// of loader, one pass of it per epoch
+func (nn *NeuralNetwork) TrainLoader(loader *utils.DataLoader) error {
+	batchNum := loader.Len()
+	if batchNum == 0 {
+		return fmt.Errorf("loader has no batches")
+	}
 
-		load := progressBars.MakeBar(batchNum, fmt.Sprintf("Epoch #%d", e+1))
-		progressBars.Bars[e].Width = 60
+	progress := nn.config.Progress
+	if progress == nil {
+		if bars := newTerminalBars(nn.config.NumEpochs, batchNum); bars != nil {
+			defer bars.done()
+			progress = bars.update
+		}
+	}
 
-		// shuffle inputs
-		rand.Seed(time.Now().UnixNano())
-		rand.Shuffle(setSize, func(i, j int) { inputArr[i], inputArr[j] = inputArr[j], inputArr[i] })
+	// epochs run in order, each one's batches split across the workers
+	for e := 0; e < nn.config.NumEpochs; e++ {
+		nn.syncUpdate(func() {
+			nn.epoch = e
+		})
 
-		go func() {
-			wg.Add(1)
-			for i := 0; i < batchNum; i++ {
-				load(i)
-				// get batch for training
-				batch := inputArr[i*nn.config.BatchSize : (i+1)*nn.config.BatchSize]
-				nn.TrainBatch(batch, expected, nn.config.BatchSize, &wg)
-			}
-		}()
+		epochLoss, err := nn.trainEpoch(loader, e, progress)
+		if err != nil {
+			return err
+		}
+
+		nn.endEpoch(e, epochLoss/float64(batchNum))
 	}
 
-	go progressBars.Listen()
+	return nil
+}
 
-	wg.Wait()
+// trainEpoch trains on one pass of loader as the given epoch, returning the sum
+// of the batch losses. progress, if not nil, is called after each batch
+func (nn *NeuralNetwork) trainEpoch(loader *utils.DataLoader, epoch int, progress ProgressFunc) (float64, error) {
+	it := loader.Iter()
+	defer it.Close()
 
+	epochLoss := 0.0
+	for i := 0; it.Next(); i++ {
+		batch := it.Batch()
+		batchLoss, err := nn.TrainBatch(batch.Inputs, batch.Targets)
+		if err != nil {
+			return 0, err
+		}
+		epochLoss += batchLoss
+		if progress != nil {
+			progress(epoch, i+1, loader.Len())
+		}
+	}
+	return epochLoss, nil
 }
 
-// TrainBatch trains the network on the batch of inputs, entirely
-func (nn *NeuralNetwork) TrainBatch(inputArr, expected [][]float64, setSize int, wg *sync.WaitGroup) error {
-	defer wg.Done()
-	var finalLayer *NeuronLayer
-	if len(nn.layers) > 0 {
-		finalLayer = nn.layers[len(nn.layers)-1]
+// TrainBatch trains the network on the batch of inputs, entirely, and returns
+// the mean loss per sample over the batch. The batch is split between
+// [nn.config.Workers] goroutines and their gradients summed (in order, so
+// the result doesn't depend on scheduling) before one update is applied
+func (nn *NeuralNetwork) TrainBatch(inputArr, expected [][]float64) (float64, error) {
+	setSize := len(inputArr)
+	if setSize == 0 || len(expected) != setSize {
+		return 0, fmt.Errorf("batch has %d inputs and %d expected outputs", setSize, len(expected))
 	}
-	for s := 0; s < setSize; s++ {
-		// printProgress("Epoch", float64(s), float64(setSize), 50.0)
-		// loader.PrintSimpleLoader("Epoch", stage)
 
-		// feed forward thru nn layers
-		inputs := mat.NewDense(len(inputArr[s]), 1, inputArr[s])
+	workers := nn.config.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > setSize {
+		workers = setSize
+	}
 
-		// concurrent-aware forward prop
-		err := nn.forwardSync(inputs)
-		if err != nil {
-			return err
+	// each worker draws its dropout masks from its own source, seeded from the
+	// network's so the run is reproducible whatever the scheduling
+	var seed int64
+	nn.syncUpdate(func() {
+		seed = nn.rng.Int63()
+	})
+
+	// each worker runs its own contiguous slice of the batch through replicas
+	// of the layers, which share the weights but keep their own outputs
+	results := make([]workerResult, workers)
+	shards := make([][]Layer, workers)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		start, end := w*setSize/workers, (w+1)*setSize/workers
+
+		layers := nn.layers
+		if w > 0 {
+			layers = replicas(nn.layers)
 		}
+		shards[w] = layers
+
+		wg.Add(1)
+		go func(w int, layers []Layer) {
+			defer wg.Done()
+			// stack the shard into single matrices, one column per sample, so
+			// each layer runs one matrix product for all of it
+			inputs := batchMatrix(inputArr[start:end])
+			targets := batchMatrix(expected[start:end])
+			rng := rand.New(rand.NewSource(seed + int64(w)))
+			results[w] = nn.backprop(layers, inputs, targets, Training, rng)
+		}(w, layers)
+	}
+	wg.Wait()
+
+	// reduce the workers' summed gradients and scale by 1 / batch size to average them
+	avg := 1.0 / float64(setSize)
+	params := results[0].params
+	batchLoss := results[0].loss
+	for _, res := range results[1:] {
+		for k := range params {
+			params[k].Grad.Add(params[k].Grad, res.params[k].Grad)
+		}
+		batchLoss += res.loss
+	}
+	for k := range params {
+		params[k].Grad.Scale(avg, params[k].Grad)
+	}
+	batchLoss *= avg
+
+	// the penalties apply once per batch, on top of the averaged gradients
+	pens := nn.penalties()
+	batchLoss += penalize(params, pens)
+
+	nn.syncUpdate(func() {
+		rate := nn.learningRate()
+		nn.optimizer.Step(params, rate)
+		decay(params, pens, rate)
+		mergeStats(shards)
+		nn.step++
+		nn.history.BatchLoss = append(nn.history.BatchLoss, batchLoss)
+	})
+
+	return batchLoss, nil
+}
+
+// workerResult is one worker's share of a batch: loss and gradients summed over its samples
+type workerResult struct {
+	loss   float64
+	params []Param
+}
 
-		// BACKPROP === followed https://sausheong.github.io/posts/how-to-build-a-simple-artificial-neural-network-with-go/ to learn ;]
+// backprop runs inputs forward through layers in mode and the loss back,
+// returning the loss and each layer's gradients summed over the samples
+func (nn *NeuralNetwork) backprop(layers []Layer, inputs, targets *mat.Dense, mode Mode, rng *rand.Rand) workerResult {
+	finalLayer := layers[len(layers)-1]
 
-		targets := mat.NewDense(len(expected[s]), 1, expected[s])
+	// feed forward thru nn layers
+	output := forward(layers, inputs, mode, rng)
 
+	// BACKPROP === followed https://sausheong.github.io/posts/how-to-build-a-simple-artificial-neural-network-with-go/ to learn ;]
+
+	loss := mat.Sum(nn.lossFunc.Apply(output, targets))
+
+	// dOutput is the gradient of the loss with respect to the current layer's
+	// output, passed back a layer at a time from the last
+	var dOutput *mat.Dense
+	if fused, ok := nn.fusedOutput(finalLayer); ok {
+		// softmax + cross entropy (or sigmoid + binary CE) collapses to the stable (p - t), skipping the jacobian
+		dOutput = fused.backwardDelta(Subtract(output, targets).(*mat.Dense), nil)
+	} else {
 		// derivative of loss func with respect to the output of the last layer
-		oldError := nn.lossFunc.ApplyPrime(finalLayer.output, targets).(*mat.Dense)
-		dLoss := Mult(oldError, finalLayer.activation.ApplyPrime(finalLayer.output)).(*mat.Dense)
+		dOutput = finalLayer.Backward(dense(nn.lossFunc.ApplyPrime(output, targets)))
+	}
 
-		nn.syncUpdate(func() {
-			// add the scaled change to the weights
-			finalWeights := Add(finalLayer.weights,
-				// find d w respect to weights and scale the change by the learning rate to prevent overfit
-				Scale(nn.config.LearningRate, Dot(dLoss, nn.layers[len(nn.layers)-2].output.T()))).(*mat.Dense)
-
-			// add the scaled change to the bias
-			finalBias := Add(finalLayer.bias,
-				// scale dLoss by learning rate to prevent overfit
-				Scale(nn.config.LearningRate, sumAlongAxis(1, dLoss))).(*mat.Dense)
-
-			// update the values
-			finalLayer.Update(finalWeights, finalBias) // may want to change this so the calcs can be outside the syncUpdate func, but if that affect concurrency
-		})
+	for i := len(layers) - 2; i >= 0; i-- {
+		dOutput = layers[i].Backward(dOutput)
+	}
 
-		// start w/ 2nd to last bc we just did this one
-		for i := len(nn.layers) - 2; i >= 0; i-- {
-			layer := nn.layers[i]
-			nextLayer := nn.layers[i+1]
-
-			// previous layers outputs (may just be inputs)
-			var prevOut *mat.Dense
-			if i == 0 {
-				prevOut = inputs
-			} else {
-				prevOut = nn.layers[i-1].output
-			}
-
-			// do what we just did to the final layer to the rest of 'eem
-			nn.syncUpdate(func() {
-				// should probably be a setter
-				// layer.dLoss = Dot(prevWeights.T(), prevLosses).(*mat.Dense)
-				// prevLoss := nn.layers[i].dLoss
-				oldError = Dot(nextLayer.output.T(), oldError).(*mat.Dense)
-				fmt.Println(oldError)
-				layerLoss := Mul(oldError, layer.activation.ApplyPrime(layer.output)).(*mat.Dense)
-
-				hiddenWeights := Add(layer.weights,
-					// the hidden layers use a shortcut to find the error by doing the dot product below
-					Scale(nn.config.LearningRate, Dot(layerLoss, prevOut.T()))).(*mat.Dense)
-
-				hiddenBias := Add(layer.bias,
-					Scale(nn.config.LearningRate, sumAlongAxis(1, layerLoss))).(*mat.Dense)
-
-				layer.Update(hiddenWeights, hiddenBias)
-			})
+	// collect every layer's gradients first, then hand them all to the optimizer
+	var params []Param
+	for _, layer := range layers {
+		grads := layer.Grads()
+		for k, p := range layer.Params() {
+			params = append(params, Param{Value: p, Grad: grads[k], Bias: !isWeight(layer, k)})
 		}
 	}
 
-	return nil
+	return workerResult{loss: loss, params: params}
+}
+
+// SetValidation gives the network held out data to compute a loss on after
+// every epoch. It's recorded in the History and drives any LossObserver scheduler
+func (nn *NeuralNetwork) SetValidation(inputArr, expected [][]float64) {
+	nn.mu.Lock()
+	defer nn.mu.Unlock()
+	nn.validInputs = inputArr
+	nn.validExpected = expected
+}
+
+// History returns the losses recorded by training so far
+func (nn *NeuralNetwork) History() History {
+	nn.mu.Lock()
+	defer nn.mu.Unlock()
+	return nn.history
 }
 
-// Predict using the trained model feeding forward
+// Predict using the trained model feeding forward. It's safe to call while
+// the network trains: it waits out any update to the params in progress
 func (nn *NeuralNetwork) Predict(inputData []float64) (mat.Matrix, error) {
+	nn.mu.RLock()
+	defer nn.mu.RUnlock()
+	return nn.predictBatch(mat.NewDense(len(inputData), 1, inputData)), nil
+}
 
-	prevLayerOutputs := mat.NewDense(len(inputData), 1, inputData)
-	for _, layer := range nn.layers {
-		hiddenInputs := Dot(layer.weights, prevLayerOutputs)
-		prevLayerOutputs = layer.activation.Apply(Add(hiddenInputs, layer.bias)).(*mat.Dense)
-	}
+// predictBatch feeds a matrix of samples (one per column) forward in
+// Inference mode. Replicas keep each layer's forward state apart from the
+// workers', but share their params, so the caller must hold nn.mu to keep the
+// optimizer from updating them part way through
+func (nn *NeuralNetwork) predictBatch(inputs *mat.Dense) *mat.Dense {
+	return forward(replicas(nn.layers), inputs, Inference, nil)
+}
 
-	return prevLayerOutputs, nil
+// endEpoch records the epoch's losses and lets the scheduler know how it went
+func (nn *NeuralNetwork) endEpoch(e int, epochLoss float64) {
+	nn.syncUpdate(func() {
+		nn.history.EpochLoss = append(nn.history.EpochLoss, epochLoss)
 
+		observed := epochLoss
+		if len(nn.validInputs) > 0 {
+			outputs := nn.predictBatch(batchMatrix(nn.validInputs))
+			observed = ReduceLoss(nn.lossFunc, outputs, batchMatrix(nn.validExpected))
+			nn.history.ValidationLoss = append(nn.history.ValidationLoss, observed)
+		}
+		if o, ok := nn.config.Scheduler.(LossObserver); ok {
+			o.Observe(e, observed)
+		}
+	})
+}
+
+// learningRate for the current step, from the scheduler if there is one
+func (nn *NeuralNetwork) learningRate() float64 {
+	if nn.config.Scheduler == nil {
+		return nn.config.LearningRate
+	}
+	return nn.config.Scheduler.Rate(nn.config.LearningRate, nn.epoch, nn.step)
 }
 
 // private
@@ -198,61 +447,67 @@ func printProgress(label string, done float64, total float64, width float64) {
 	}
 }
 
-// func (nn *NeuralNetwork) Save() {
-// 	h, err := os.Create("data/zmlp-hidden-weights.model")
-// 	defer h.Close()
-// 	if err == nil {
-// 		nn.hiddenWeights.MarshalBinaryTo(h)
-// 		fmt.Println("Saved hidden weights")
-// 	}
-// 	o, err := os.Create("data/zmlp-output-weights.model")
-// 	defer o.Close()
-// 	if err == nil {
-// 		nn.outputWeights.MarshalBinaryTo(o)
-// 		fmt.Println("saved output weights")
-// 	}
-// 	o, err = os.Create("data/zmlp-output-bias.model")
-// 	defer o.Close()
-// 	if err == nil {
-// 		nn.outputBias.MarshalBinaryTo(o)
-// 		fmt.Println("saved output bias")
-// 	}
-// 	o, err = os.Create("data/zmlp-hidden-bias.model")
-// 	defer o.Close()
-// 	if err == nil {
-// 		nn.hiddenBias.MarshalBinaryTo(o)
-// 		fmt.Println("saved hidden bias")
-// 	}
-// }
-
-// load a neural network from file
-// func (nn *NeuralNetwork) Load() {
-// 	h, err := os.Open("data/hweights.model")
-// 	defer h.Close()
-// 	if err == nil {
-// 		net.hiddenWeights.Reset()
-// 		net.hiddenWeights.UnmarshalBinaryFrom(h)
-// 	}
-// 	o, err := os.Open("data/oweights.model")
-// 	defer o.Close()
-// 	if err == nil {
-// 		net.outputWeights.Reset()
-// 		net.outputWeights.UnmarshalBinaryFrom(o)
-// 	}
-// 	return
-// }
-
-func (nn *NeuralNetwork) forwardSync(inputs *mat.Dense) error {
+// forward feeds inputs through the layers in mode, keeping what each needs
+// for backprop, and returns the last one's output
+func forward(layers []Layer, inputs *mat.Dense, mode Mode, rng *rand.Rand) *mat.Dense {
 	prevLayerOutputs := inputs
-	for _, layer := range nn.layers {
-		nn.mu.Lock()
-		hiddenInputs := Dot(layer.weights, prevLayerOutputs)
-		layer.output = layer.activation.Apply(Add(hiddenInputs, layer.bias)).(*mat.Dense)
-		prevLayerOutputs = layer.output
-		nn.mu.Unlock()
+	for _, layer := range layers {
+		prevLayerOutputs = layer.Forward(prevLayerOutputs, mode, rng)
 	}
+	return prevLayerOutputs
+}
 
-	return nil
+// replicas of each of the layers, for a worker to run
+func replicas(layers []Layer) []Layer {
+	replicas := make([]Layer, len(layers))
+	for i, layer := range layers {
+		replicas[i] = layer.Replica()
+	}
+	return replicas
+}
+
+// mergeStats lets each statsLayer gather what its replicas saw of a batch
+func mergeStats(shards [][]Layer) {
+	for i, layer := range shards[0] {
+		sl, ok := layer.(statsLayer)
+		if !ok {
+			continue
+		}
+		replicas := make([]Layer, len(shards))
+		for w := range shards {
+			replicas[w] = shards[w][i]
+		}
+		sl.mergeStats(replicas)
+	}
+}
+
+// fusedOutput reports whether the output layer and loss can share one gradient
+// (softmax paired with cross entropy, or sigmoid with binary cross entropy)
+func (nn *NeuralNetwork) fusedOutput(finalLayer Layer) (fusedLayer, bool) {
+	fused, ok := finalLayer.(fusedLayer)
+	if !ok {
+		return nil, false
+	}
+	switch fused.outputActivation().(type) {
+	case SoftmaxStruct:
+		_, ok := nn.lossFunc.(CE)
+		return fused, ok
+	case SigmoidStruct:
+		_, ok := nn.lossFunc.(BCE)
+		return fused, ok
+	}
+	return nil, false
+}
+
+// newRand picks the network's random source from its config
+func newRand(config NNConfig) *rand.Rand {
+	if config.Source != nil {
+		return rand.New(config.Source)
+	}
+	if config.RandomSeed {
+		return rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return rand.New(rand.NewSource(config.Seed))
 }
 
 // syncs updates thru goroutines
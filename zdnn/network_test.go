@@ -0,0 +1,138 @@
+package zdnn
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/zaviermiller/zml/utils"
+	"gonum.org/v1/gonum/mat"
+)
+
+// xorNet builds a small seeded network for the tests
+func xorNet(t *testing.T, config NNConfig) *NeuralNetwork {
+	t.Helper()
+	hidden, err := NewLayer(LayerConfig{Neurons: 4, Activation: Tanh})
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := NewLayer(LayerConfig{Neurons: 2, Activation: Softmax})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.InputNeurons = 2
+	config.HiddenLayers = []Layer{hidden}
+	config.OutputLayer = output
+	config.LossFunc = CrossEntropy
+	config.LearningRate = .1
+	nn, err := NewNetwork(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return nn
+}
+
+var (
+	xorInputs   = [][]float64{{0, 0}, {0, 1}, {1, 0}, {1, 1}}
+	xorExpected = [][]float64{{1, 0}, {0, 1}, {0, 1}, {1, 0}}
+)
+
+func TestSeedZeroIsReproducible(t *testing.T) {
+	var outputs []mat.Matrix
+	for run := 0; run < 2; run++ {
+		nn := xorNet(t, NNConfig{Seed: 0})
+		for step := 0; step < 5; step++ {
+			if _, err := nn.TrainBatch(xorInputs, xorExpected); err != nil {
+				t.Fatal(err)
+			}
+		}
+		output, err := nn.Predict(xorInputs[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		outputs = append(outputs, output)
+	}
+	if !mat.Equal(outputs[0], outputs[1]) {
+		t.Errorf("two runs with seed 0 predicted %v and %v", mat.Formatted(outputs[0].T()), mat.Formatted(outputs[1].T()))
+	}
+}
+
+// TestPredictWhileTraining is meant for go test -race: Predict must not read
+// the params while the optimizer updates them
+func TestPredictWhileTraining(t *testing.T) {
+	nn := xorNet(t, NNConfig{NumEpochs: 20, BatchSize: 2, Workers: 2, Prefetch: 1, Optimizer: NewAdam()})
+	data, err := utils.NewSliceDataset(xorInputs, xorExpected)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for g := 0; g < 2; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if _, err := nn.Predict(xorInputs[g]); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(g)
+	}
+
+	if err := nn.Train(data); err != nil {
+		t.Error(err)
+	}
+	close(done)
+	wg.Wait()
+}
+
+func TestTrainReportsProgress(t *testing.T) {
+	type call struct{ epoch, done, batches int }
+	var calls []call
+	nn := xorNet(t, NNConfig{NumEpochs: 3, BatchSize: 2, Progress: func(epoch, done, batches int) {
+		calls = append(calls, call{epoch, done, batches})
+	}})
+	data, err := utils.NewSliceDataset(xorInputs, xorExpected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := nn.Train(data); err != nil {
+		t.Fatal(err)
+	}
+
+	var want []call
+	for e := 0; e < 3; e++ {
+		want = append(want, call{e, 1, 2}, call{e, 2, 2})
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("progress was called with %v, want %v", calls, want)
+	}
+	if epochs := len(nn.History().EpochLoss); epochs != 3 {
+		t.Errorf("trained %d epochs, want 3", epochs)
+	}
+}
+
+// TestTrainWithoutProgress trains the way an unattended run does: with no
+// Progress and, under go test, no terminal to draw bars on
+func TestTrainWithoutProgress(t *testing.T) {
+	data, err := utils.NewSliceDataset(xorInputs, xorExpected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, epochs := range []int{0, 2} {
+		nn := xorNet(t, NNConfig{NumEpochs: epochs, BatchSize: 2})
+		if err := nn.Train(data); err != nil {
+			t.Fatal(err)
+		}
+		if got := len(nn.History().EpochLoss); got != epochs {
+			t.Errorf("trained %d epochs, want %d", got, epochs)
+		}
+	}
+}
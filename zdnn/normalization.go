@@ -0,0 +1,296 @@
+package zdnn
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// NormConfig is the configuration for a BatchNorm or LayerNorm layer.
+// DefaultNormConfig has the usual settings; the fields are used as they are,
+// and Epsilon must be positive so a feature with no variance can't divide by 0
+type NormConfig struct {
+	// Momentum is how much of the running mean and variance BatchNorm keeps
+	// on each batch (0.9 by default). LayerNorm has no running statistics
+	Momentum float64
+
+	// Epsilon is added to the variance before its square root (1e-5 by default)
+	Epsilon float64
+}
+
+// DefaultNormConfig is the usual configuration for a norm layer
+func DefaultNormConfig() NormConfig {
+	return NormConfig{Momentum: 0.9, Epsilon: 1e-5}
+}
+
+// NewBatchNorm builds a layer normalizing each of its inputs to zero mean and
+// unit variance across the batch, then scaling by a learned gamma and shifting
+// by a learned beta. While training it uses the batch's statistics and keeps a
+// running mean and variance for inference. With more than one worker each
+// normalizes its share of the batch by that share's own statistics, while the
+// running statistics are kept for the whole batch
+func NewBatchNorm(config NormConfig) (*NormLayer, error) {
+	if !(config.Momentum >= 0 && config.Momentum < 1) {
+		return nil, fmt.Errorf("batch norm momentum %v is outside [0, 1)", config.Momentum)
+	}
+	if !(config.Epsilon > 0) {
+		return nil, fmt.Errorf("batch norm epsilon %v isn't positive", config.Epsilon)
+	}
+	return newNorm(true, config), nil
+}
+
+// NewLayerNorm builds a layer normalizing each sample across its inputs, then
+// scaling by a learned gamma and shifting by a learned beta. It doesn't depend
+// on the batch, so works the same in training and inference
+func NewLayerNorm(config NormConfig) (*NormLayer, error) {
+	if !(config.Momentum >= 0 && config.Momentum < 1) {
+		return nil, fmt.Errorf("layer norm momentum %v is outside [0, 1)", config.Momentum)
+	}
+	if !(config.Epsilon > 0) {
+		return nil, fmt.Errorf("layer norm epsilon %v isn't positive", config.Epsilon)
+	}
+	return newNorm(false, config), nil
+}
+
+// NormLayer is a BatchNorm or LayerNorm layer. Matrices have one row per
+// input; a batch has one column per sample
+type NormLayer struct {
+	// batch normalizes each row across the columns, otherwise each column
+	// is normalized across the rows
+	batch    bool
+	momentum float64
+	epsilon  float64
+
+	gamma *mat.Dense
+	beta  *mat.Dense
+
+	// BatchNorm's estimates of the mean and variance of each input, for inference
+	runningMean *mat.Dense
+	runningVar  *mat.Dense
+
+	// kept from the forward pass for backprop: the normalized input and
+	// 1 / sqrt(var + epsilon) of each row (batch) or column (layer)
+	xhat   *mat.Dense
+	invStd []float64
+
+	// the statistics of the last training batch, and how many samples it had,
+	// to fold into the running ones
+	mean     []float64
+	variance []float64
+	count    int
+
+	// from the last backward pass
+	grads []*mat.Dense
+}
+
+func newNorm(batch bool, config NormConfig) *NormLayer {
+	return &NormLayer{
+		batch:    batch,
+		momentum: config.Momentum,
+		epsilon:  config.Epsilon,
+	}
+}
+
+// Build starts gamma at 1 and beta at 0, so the layer starts as a plain
+// normalization. The size is unchanged
+func (n *NormLayer) Build(size int, rng *rand.Rand) (int, error) {
+	n.gamma = mat.NewDense(size, 1, nil)
+	n.beta = mat.NewDense(size, 1, nil)
+	n.runningMean = mat.NewDense(size, 1, nil)
+	n.runningVar = mat.NewDense(size, 1, nil)
+	for i := 0; i < size; i++ {
+		n.gamma.Set(i, 0, 1)
+		n.runningVar.Set(i, 0, 1)
+	}
+	return size, nil
+}
+
+// BuildShape leaves the shape unchanged. Each value is still normalized on its own
+func (n *NormLayer) BuildShape(input Shape, rng *rand.Rand) (Shape, error) {
+	_, err := n.Build(input.Size(), rng)
+	return input, err
+}
+
+// Replica shares the learned and running values but keeps its own forward state
+func (n *NormLayer) Replica() Layer {
+	return &NormLayer{
+		batch:       n.batch,
+		momentum:    n.momentum,
+		epsilon:     n.epsilon,
+		gamma:       n.gamma,
+		beta:        n.beta,
+		runningMean: n.runningMean,
+		runningVar:  n.runningVar,
+	}
+}
+
+// Params are gamma then beta
+func (n *NormLayer) Params() []*mat.Dense {
+	return []*mat.Dense{n.gamma, n.beta}
+}
+
+func (n *NormLayer) Grads() []*mat.Dense {
+	return n.grads
+}
+
+func (n *NormLayer) paramNames() []string {
+	return []string{"gamma", "beta"}
+}
+
+// Forward normalizes input, keeping what Backward needs. BatchNorm uses the
+// batch's statistics in Training mode and the running ones otherwise
+func (n *NormLayer) Forward(input *mat.Dense, mode Mode, rng *rand.Rand) *mat.Dense {
+	r, c := input.Dims()
+	n.mean, n.variance, n.count = nil, nil, 0
+
+	var mean, variance []float64
+	switch {
+	case !n.batch:
+		mean, variance = moments(input.T())
+	case mode == Training:
+		mean, variance = moments(input)
+		n.mean, n.variance, n.count = mean, variance, c
+	default:
+		mean = mat.Col(nil, 0, n.runningMean)
+		variance = mat.Col(nil, 0, n.runningVar)
+	}
+
+	n.invStd = make([]float64, len(variance))
+	for k, v := range variance {
+		n.invStd[k] = 1 / math.Sqrt(v+n.epsilon)
+	}
+
+	n.xhat = mat.NewDense(r, c, nil)
+	n.xhat.Apply(func(i, j int, val float64) float64 {
+		k := i
+		if !n.batch {
+			k = j
+		}
+		return (val - mean[k]) * n.invStd[k]
+	}, input)
+
+	out := mat.NewDense(r, c, nil)
+	out.Apply(func(i, _ int, val float64) float64 {
+		return n.gamma.At(i, 0)*val + n.beta.At(i, 0)
+	}, n.xhat)
+	return out
+}
+
+// Backward takes the gradient of the loss with respect to the layer's output
+// and returns it with respect to the input, keeping the gamma and beta
+// gradients summed over the samples
+func (n *NormLayer) Backward(dOutput *mat.Dense) *mat.Dense {
+	r, c := dOutput.Dims()
+
+	n.grads = []*mat.Dense{sumAlongAxis(1, Mult(dOutput, n.xhat).(*mat.Dense)), sumAlongAxis(1, dOutput)}
+
+	// the gradient with respect to the normalized input
+	dXhat := mat.NewDense(r, c, nil)
+	dXhat.Apply(func(i, _ int, val float64) float64 { return val * n.gamma.At(i, 0) }, dOutput)
+
+	dInput := mat.NewDense(r, c, nil)
+	if n.batch && n.count == 0 {
+		// normalized by the running statistics, which are constants here
+		dInput.Apply(func(i, _ int, val float64) float64 { return val * n.invStd[i] }, dXhat)
+		return dInput
+	}
+
+	// the mean and variance depend on every value they were taken over, so
+	// dx = invStd / m * (m * dxhat - sum(dxhat) - xhat * sum(dxhat * xhat)),
+	// summing over the m values in the same row (batch) or column (layer)
+	var sum, sumXhat []float64
+	m := float64(c)
+	if n.batch {
+		sum = mat.Col(nil, 0, sumAlongAxis(1, dXhat))
+		sumXhat = mat.Col(nil, 0, sumAlongAxis(1, Mult(dXhat, n.xhat).(*mat.Dense)))
+	} else {
+		m = float64(r)
+		sum = mat.Row(nil, 0, sumAlongAxis(0, dXhat))
+		sumXhat = mat.Row(nil, 0, sumAlongAxis(0, Mult(dXhat, n.xhat).(*mat.Dense)))
+	}
+	dInput.Apply(func(i, j int, val float64) float64 {
+		k := i
+		if !n.batch {
+			k = j
+		}
+		return n.invStd[k] / m * (m*val - sum[k] - n.xhat.At(i, j)*sumXhat[k])
+	}, dXhat)
+
+	return dInput
+}
+
+// mergeStats folds the statistics each replica saw of its shard of a training
+// batch into the running mean and variance, as if they had been taken over the
+// whole batch. It's a no-op for LayerNorm
+func (n *NormLayer) mergeStats(replicas []Layer) {
+	if !n.batch {
+		return
+	}
+	shards := make([]*NormLayer, len(replicas))
+	for w, r := range replicas {
+		shards[w] = r.(*NormLayer)
+	}
+
+	total := 0
+	for _, s := range shards {
+		total += s.count
+	}
+	if total == 0 {
+		return
+	}
+
+	rows, _ := n.runningMean.Dims()
+	for i := 0; i < rows; i++ {
+		mean := 0.0
+		for _, s := range shards {
+			mean += float64(s.count) * s.mean[i]
+		}
+		mean /= float64(total)
+
+		// the variance within each shard plus the spread of the shards' means
+		variance := 0.0
+		for _, s := range shards {
+			d := s.mean[i] - mean
+			variance += float64(s.count) * (s.variance[i] + d*d)
+		}
+		variance /= float64(total)
+		if total > 1 {
+			// unbiased, to estimate the variance of the whole data set
+			variance *= float64(total) / float64(total-1)
+		}
+
+		n.runningMean.Set(i, 0, n.momentum*n.runningMean.At(i, 0)+(1-n.momentum)*mean)
+		n.runningVar.Set(i, 0, n.momentum*n.runningVar.At(i, 0)+(1-n.momentum)*variance)
+	}
+}
+
+// state is gamma then beta, followed by the running mean and variance for
+// BatchNorm, which are saved with the model but not trained
+func (n *NormLayer) state() []*mat.Dense {
+	state := []*mat.Dense{n.gamma, n.beta}
+	if n.batch {
+		state = append(state, n.runningMean, n.runningVar)
+	}
+	return state
+}
+
+// moments are the mean and (biased) variance of each row of m
+func moments(m mat.Matrix) (mean, variance []float64) {
+	r, c := m.Dims()
+	mean = make([]float64, r)
+	variance = make([]float64, r)
+	for i := 0; i < r; i++ {
+		for j := 0; j < c; j++ {
+			mean[i] += m.At(i, j)
+		}
+		mean[i] /= float64(c)
+		for j := 0; j < c; j++ {
+			d := m.At(i, j) - mean[i]
+			variance[i] += d * d
+		}
+		variance[i] /= float64(c)
+	}
+	return mean, variance
+}
@@ -0,0 +1,81 @@
+package zdnn
+
+import (
+	"math"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestNormConfigValidation(t *testing.T) {
+	for _, config := range []NormConfig{{}, {Momentum: .9}, {Momentum: 1, Epsilon: 1e-5}, {Momentum: -.1, Epsilon: 1e-5}} {
+		if _, err := NewBatchNorm(config); err == nil {
+			t.Errorf("NewBatchNorm accepted %+v", config)
+		}
+		if _, err := NewLayerNorm(config); err == nil {
+			t.Errorf("NewLayerNorm accepted %+v", config)
+		}
+	}
+}
+
+func TestBatchNormRunningStatistics(t *testing.T) {
+	bn, err := NewBatchNorm(NormConfig{Momentum: .5, Epsilon: 1e-5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bn.Build(2, nil); err != nil {
+		t.Fatal(err)
+	}
+	// the second feature is constant, so has no variance
+	batch := mat.NewDense(2, 4, []float64{
+		1, 2, 3, 6,
+		5, 5, 5, 5,
+	})
+
+	// training normalizes by the batch's own statistics, leaving the
+	// running ones alone until they're merged
+	replica := bn.Replica().(*NormLayer)
+	out := replica.Forward(batch, Training, nil)
+	for j, x := range []float64{1, 2, 3, 6} {
+		// the batch has mean 3 and (biased) variance 3.5
+		want := (x - 3) / math.Sqrt(3.5+1e-5)
+		if got := out.At(0, j); math.Abs(got-want) > 1e-12 {
+			t.Errorf("trained output %d is %v, want %v", j, got, want)
+		}
+		if got := out.At(1, j); got != 0 {
+			t.Errorf("trained output %d of the constant feature is %v, want 0", j, got)
+		}
+	}
+	if bn.runningMean.At(0, 0) != 0 || bn.runningVar.At(0, 0) != 1 {
+		t.Errorf("running statistics changed before they were merged")
+	}
+
+	// half of the old statistics are kept, and the variance is unbiased
+	bn.mergeStats([]Layer{replica})
+	wantMean := []float64{.5 * 3, .5 * 5}
+	wantVar := []float64{.5 + .5*3.5*4/3, .5}
+	for i := range wantMean {
+		if got := bn.runningMean.At(i, 0); math.Abs(got-wantMean[i]) > 1e-12 {
+			t.Errorf("running mean %d is %v, want %v", i, got, wantMean[i])
+		}
+		if got := bn.runningVar.At(i, 0); math.Abs(got-wantVar[i]) > 1e-12 {
+			t.Errorf("running variance %d is %v, want %v", i, got, wantVar[i])
+		}
+	}
+
+	// inference normalizes by the running statistics, even a single sample
+	sample := mat.NewDense(2, 1, []float64{3, 5})
+	out = bn.Replica().Forward(sample, Inference, nil)
+	for i, x := range []float64{3, 5} {
+		want := (x - wantMean[i]) / math.Sqrt(wantVar[i]+1e-5)
+		if got := out.At(i, 0); math.Abs(got-want) > 1e-12 {
+			t.Errorf("inference output %d is %v, want %v", i, got, want)
+		}
+	}
+
+	// and a training batch of one has no variance to divide by
+	out = bn.Replica().Forward(sample, Training, nil)
+	if v := out.At(0, 0); math.IsNaN(v) || math.IsInf(v, 0) {
+		t.Errorf("a training batch of one gave %v", v)
+	}
+}
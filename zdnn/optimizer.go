@@ -0,0 +1,286 @@
+package zdnn
+
+import (
+	"fmt"
+	"math"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Param is a trainable matrix paired with the (batch averaged) gradient of the loss with respect to it
+type Param struct {
+	Value *mat.Dense
+	Grad  *mat.Dense
+
+	// Bias marks bias vectors (and other offsets like a learned PReLU slope),
+	// which weight decay leaves alone
+	Bias bool
+}
+
+// Optimizer applies gradients to parameters, keeping whatever per-parameter
+// state it needs between steps. State is keyed by the Value matrix, which
+// Step updates in place
+type Optimizer interface {
+	Step(params []Param, rate float64)
+}
+
+// validator is implemented by the built in optimizers and schedulers whose
+// settings can be out of range, so NewNetwork can reject them up front
+type validator interface {
+	validate() error
+}
+
+// validate errors if v is a validator with bad settings
+func validate(v interface{}) error {
+	if vr, ok := v.(validator); ok {
+		return vr.validate()
+	}
+	return nil
+}
+
+// SGD is plain gradient descent: w -= rate * g
+type SGD struct{}
+
+// Momentum is SGD with a velocity that accumulates past gradients. NewMomentum
+// gives the usual settings; the fields are used as they are, so 0 means 0
+type Momentum struct {
+	// Momentum is how much velocity carries over each step (0.9 from NewMomentum)
+	Momentum float64
+
+	velocity map[*mat.Dense]*mat.Dense
+}
+
+// Nesterov is momentum that steps using the gradient looked ahead along the
+// velocity. NewNesterov gives the usual settings
+type Nesterov struct {
+	// Momentum is how much velocity carries over each step (0.9 from NewNesterov)
+	Momentum float64
+
+	velocity map[*mat.Dense]*mat.Dense
+}
+
+// RMSProp scales each step by a running average of squared gradients.
+// NewRMSProp gives the usual settings. Epsilon must be set: NewNetwork
+// rejects the zero value
+type RMSProp struct {
+	// Decay of the squared gradient average (0.9 from NewRMSProp)
+	Decay float64
+	// Epsilon keeps the division stable (1e-8 from NewRMSProp)
+	Epsilon float64
+
+	meanSquare map[*mat.Dense]*mat.Dense
+}
+
+// Adam keeps bias-corrected running averages of the gradient and its square.
+// NewAdam gives the usual settings. Epsilon must be set: NewNetwork rejects
+// the zero value
+type Adam struct {
+	// Beta1 and Beta2 are the decay of the first and second moments (0.9 and
+	// 0.999 from NewAdam)
+	Beta1 float64
+	Beta2 float64
+	// Epsilon keeps the division stable (1e-8 from NewAdam)
+	Epsilon float64
+
+	moments map[*mat.Dense]*adamMoments
+}
+
+// AdamW is Adam with weight decay applied directly to the weights rather than
+// through the gradient. NewAdamW gives the usual settings
+type AdamW struct {
+	Adam
+
+	// WeightDecay shrinks non-bias params by rate * WeightDecay each step
+	// (0.01 from NewAdamW)
+	WeightDecay float64
+}
+
+// NewMomentum builds a Momentum optimizer carrying over 0.9 of the velocity
+func NewMomentum() *Momentum {
+	return &Momentum{Momentum: 0.9}
+}
+
+// NewNesterov builds a Nesterov optimizer carrying over 0.9 of the velocity
+func NewNesterov() *Nesterov {
+	return &Nesterov{Momentum: 0.9}
+}
+
+// NewRMSProp builds an RMSProp optimizer with a decay of 0.9
+func NewRMSProp() *RMSProp {
+	return &RMSProp{Decay: 0.9, Epsilon: 1e-8}
+}
+
+// NewAdam builds an Adam optimizer with the betas from the paper, 0.9 and 0.999
+func NewAdam() *Adam {
+	return &Adam{Beta1: 0.9, Beta2: 0.999, Epsilon: 1e-8}
+}
+
+// NewAdamW builds an AdamW optimizer with NewAdam's settings and a weight decay of 0.01
+func NewAdamW() *AdamW {
+	return &AdamW{Adam: *NewAdam(), WeightDecay: 0.01}
+}
+
+type adamMoments struct {
+	m, v *mat.Dense
+	t    int
+}
+
+func (o *SGD) Step(params []Param, rate float64) {
+	for _, p := range params {
+		p.Value.Sub(p.Value, Scale(rate, p.Grad))
+	}
+}
+
+func (o *Momentum) Step(params []Param, rate float64) {
+	mu := o.Momentum
+	if o.velocity == nil {
+		o.velocity = make(map[*mat.Dense]*mat.Dense)
+	}
+	for _, p := range params {
+		v := stateFor(o.velocity, p.Value)
+		// v = mu * v + g
+		v.Scale(mu, v)
+		v.Add(v, p.Grad)
+		p.Value.Sub(p.Value, Scale(rate, v))
+	}
+}
+
+func (o *Nesterov) Step(params []Param, rate float64) {
+	mu := o.Momentum
+	if o.velocity == nil {
+		o.velocity = make(map[*mat.Dense]*mat.Dense)
+	}
+	for _, p := range params {
+		v := stateFor(o.velocity, p.Value)
+		v.Scale(mu, v)
+		v.Add(v, p.Grad)
+		// step along g + mu * v, the gradient after the velocity is applied
+		p.Value.Sub(p.Value, Scale(rate, Add(p.Grad, Scale(mu, v))))
+	}
+}
+
+func (o *RMSProp) Step(params []Param, rate float64) {
+	rho, eps := o.Decay, o.Epsilon
+	if o.meanSquare == nil {
+		o.meanSquare = make(map[*mat.Dense]*mat.Dense)
+	}
+	for _, p := range params {
+		s := stateFor(o.meanSquare, p.Value)
+		// s = rho * s + (1 - rho) * g^2
+		s.Scale(rho, s)
+		s.Add(s, Scale(1-rho, Mult(p.Grad, p.Grad)))
+
+		step := Apply(func(i, j int, val float64) float64 {
+			return val / (math.Sqrt(s.At(i, j)) + eps)
+		}, p.Grad)
+		p.Value.Sub(p.Value, Scale(rate, step))
+	}
+}
+
+func (o *Adam) Step(params []Param, rate float64) {
+	beta1, beta2, eps := o.Beta1, o.Beta2, o.Epsilon
+	if o.moments == nil {
+		o.moments = make(map[*mat.Dense]*adamMoments)
+	}
+	for _, p := range params {
+		st, ok := o.moments[p.Value]
+		if !ok {
+			r, c := p.Value.Dims()
+			st = &adamMoments{m: mat.NewDense(r, c, nil), v: mat.NewDense(r, c, nil)}
+			o.moments[p.Value] = st
+		}
+		st.t++
+
+		// m = beta1 * m + (1 - beta1) * g, v = beta2 * v + (1 - beta2) * g^2
+		st.m.Scale(beta1, st.m)
+		st.m.Add(st.m, Scale(1-beta1, p.Grad))
+		st.v.Scale(beta2, st.v)
+		st.v.Add(st.v, Scale(1-beta2, Mult(p.Grad, p.Grad)))
+
+		// undo the pull towards zero the moments start with
+		mCorrection := 1 - math.Pow(beta1, float64(st.t))
+		vCorrection := 1 - math.Pow(beta2, float64(st.t))
+		step := Apply(func(i, j int, val float64) float64 {
+			return (val / mCorrection) / (math.Sqrt(st.v.At(i, j)/vCorrection) + eps)
+		}, st.m)
+		p.Value.Sub(p.Value, Scale(rate, step))
+	}
+}
+
+func (o *AdamW) Step(params []Param, rate float64) {
+	decay := o.WeightDecay
+	for _, p := range params {
+		if !p.Bias {
+			p.Value.Scale(1-rate*decay, p.Value)
+		}
+	}
+	o.Adam.Step(params, rate)
+}
+
+// checkDecay errors unless the decay of a running average is in [0, 1)
+func checkDecay(what string, val float64) error {
+	if !(val >= 0 && val < 1) {
+		return fmt.Errorf("%s %v is outside [0, 1)", what, val)
+	}
+	return nil
+}
+
+// checkEpsilon errors unless an epsilon keeping a division stable is positive
+func checkEpsilon(what string, val float64) error {
+	if !(val > 0) {
+		return fmt.Errorf("%s %v isn't positive", what, val)
+	}
+	return nil
+}
+
+func (o *Momentum) validate() error {
+	return checkDecay("momentum", o.Momentum)
+}
+
+func (o *Nesterov) validate() error {
+	return checkDecay("nesterov momentum", o.Momentum)
+}
+
+func (o *RMSProp) validate() error {
+	if err := checkDecay("rmsprop decay", o.Decay); err != nil {
+		return err
+	}
+	return checkEpsilon("rmsprop epsilon", o.Epsilon)
+}
+
+func (o *Adam) validate() error {
+	if err := checkDecay("adam beta1", o.Beta1); err != nil {
+		return err
+	}
+	if err := checkDecay("adam beta2", o.Beta2); err != nil {
+		return err
+	}
+	return checkEpsilon("adam epsilon", o.Epsilon)
+}
+
+func (o *AdamW) validate() error {
+	if o.WeightDecay < 0 {
+		return fmt.Errorf("adamw weight decay %v is negative", o.WeightDecay)
+	}
+	return o.Adam.validate()
+}
+
+// stateFor returns the zeroed-on-first-use state matrix kept for param
+func stateFor(state map[*mat.Dense]*mat.Dense, param *mat.Dense) *mat.Dense {
+	s, ok := state[param]
+	if !ok {
+		r, c := param.Dims()
+		s = mat.NewDense(r, c, nil)
+		state[param] = s
+	}
+	return s
+}
+
+// orDefault is def in place of a hyperparameter left at zero, for the few
+// (like an initializer's gain) where zero would make no sense
+func orDefault(val, def float64) float64 {
+	if val == 0 {
+		return def
+	}
+	return val
+}
@@ -0,0 +1,85 @@
+package zdnn
+
+import (
+	"math"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// stepOnce runs one step of o on a copy of value with gradient grad
+func stepOnce(o Optimizer, value, grad *mat.Dense, bias bool) *mat.Dense {
+	v := mat.DenseCopyOf(value)
+	o.Step([]Param{{Value: v, Grad: grad, Bias: bias}}, 0.1)
+	return v
+}
+
+func TestExplicitZeroHyperparameters(t *testing.T) {
+	value := mat.NewDense(2, 2, []float64{1, -2, 3, -4})
+	grad := mat.NewDense(2, 2, []float64{0.5, 0.25, -1, 2})
+
+	// AdamW with no decay is Adam
+	adam := stepOnce(NewAdam(), value, grad, false)
+	noDecay := NewAdamW()
+	noDecay.WeightDecay = 0
+	if got := stepOnce(noDecay, value, grad, false); !mat.EqualApprox(got, adam, 1e-15) {
+		t.Errorf("AdamW with WeightDecay 0 stepped to %v, Adam to %v", mat.Formatted(got), mat.Formatted(adam))
+	}
+	if got := stepOnce(NewAdamW(), value, grad, false); mat.EqualApprox(got, adam, 1e-15) {
+		t.Errorf("AdamW from NewAdamW didn't decay the weights")
+	}
+
+	// Momentum with none carried over is SGD, step after step
+	sgd, noMomentum := &SGD{}, &Momentum{Momentum: 0}
+	want, got := mat.DenseCopyOf(value), mat.DenseCopyOf(value)
+	for step := 0; step < 3; step++ {
+		sgd.Step([]Param{{Value: want, Grad: grad}}, 0.1)
+		noMomentum.Step([]Param{{Value: got, Grad: grad}}, 0.1)
+	}
+	if !mat.EqualApprox(got, want, 1e-15) {
+		t.Errorf("Momentum 0 stepped to %v, SGD to %v", mat.Formatted(got), mat.Formatted(want))
+	}
+}
+
+func TestZeroValueOptimizers(t *testing.T) {
+	tests := []struct {
+		name      string
+		optimizer Optimizer
+		ok        bool
+	}{
+		{"sgd", &SGD{}, true},
+		{"momentum", &Momentum{}, true},
+		{"nesterov", &Nesterov{}, true},
+		{"rmsprop", &RMSProp{}, false},
+		{"adam", &Adam{}, false},
+		{"adamw", &AdamW{}, false},
+		{"adam from NewAdam", NewAdam(), true},
+		{"adam beta1 1", &Adam{Beta1: 1, Beta2: .999, Epsilon: 1e-8}, false},
+		{"adam negative beta2", &Adam{Beta1: .9, Beta2: -.1, Epsilon: 1e-8}, false},
+		{"momentum 1", &Momentum{Momentum: 1}, false},
+		{"adamw negative decay", &AdamW{Adam: *NewAdam(), WeightDecay: -1}, false},
+	}
+	for _, test := range tests {
+		output, err := NewLayer(LayerConfig{Neurons: 2, Activation: Softmax})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = NewNetwork(NNConfig{InputNeurons: 2, OutputLayer: output, Optimizer: test.optimizer})
+		if test.ok && err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+		if !test.ok && err == nil {
+			t.Errorf("%s: NewNetwork accepted it", test.name)
+		}
+	}
+
+	// once accepted, a zero gradient leaves the param alone rather than making it NaN
+	value := mat.NewDense(1, 2, []float64{1, 1})
+	grad := mat.NewDense(1, 2, []float64{0, 1})
+	for _, o := range []Optimizer{NewAdam(), NewRMSProp()} {
+		got := stepOnce(o, value, grad, false)
+		if got.At(0, 0) != 1 || math.IsNaN(got.At(0, 1)) {
+			t.Errorf("%T stepped %v to %v", o, mat.Formatted(value), mat.Formatted(got))
+		}
+	}
+}
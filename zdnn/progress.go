@@ -0,0 +1,53 @@
+package zdnn
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/sethgrid/multibar"
+	"golang.org/x/sys/unix"
+)
+
+// ProgressFunc is told how training is going after every batch: the epoch
+// (from 0), how many of its batches are done and how many there are
+type ProgressFunc func(epoch, done, batches int)
+
+// barWidth is how wide the bars Train draws in a terminal are
+const barWidth = 60
+
+// terminalBars draws a progress bar per epoch. Call done once training stops
+// to move the cursor past them
+type terminalBars struct {
+	bars *multibar.BarContainer
+}
+
+// newTerminalBars makes the bars for epochs of batches each, or returns nil if
+// they can't be drawn: multibar sizes them from stdin and draws on stdout, so
+// both have to be a terminal wide enough to hold them
+func newTerminalBars(epochs, batches int) *terminalBars {
+	for _, f := range []*os.File{os.Stdin, os.Stdout} {
+		ws, err := unix.IoctlGetWinsize(int(f.Fd()), unix.TIOCGWINSZ)
+		if err != nil || int(ws.Col) < barWidth+40 {
+			return nil
+		}
+	}
+
+	// create the multibar container
+	// this allows our bars to work together without stomping on one another
+	bars, _ := multibar.New()
+	for e := 0; e < epochs; e++ {
+		bars.MakeBar(batches, fmt.Sprintf("Epoch #%d", e+1))
+		bars.Bars[e].Width = barWidth
+	}
+	return &terminalBars{bars: bars}
+}
+
+// update redraws the epoch's bar, without multibar's listener goroutine
+// (which only stops once every bar's channel is closed, and can't be)
+func (tb *terminalBars) update(epoch, done, batches int) {
+	tb.bars.Bars[epoch].Update(done)
+}
+
+func (tb *terminalBars) done() {
+	tb.bars.Println()
+}
@@ -0,0 +1,405 @@
+package zdnn
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// SequenceShape is the Shape of a sequence input: steps steps of features
+// values each, stored a step at a time
+func SequenceShape(steps, features int) Shape {
+	return Shape{Channels: 1, Height: steps, Width: features}
+}
+
+// RNNConfig is the configuration for a SimpleRNN, LSTM or GRU layer
+type RNNConfig struct {
+	// Units is the size of the hidden state
+	Units int
+
+	// ReturnSequences outputs the hidden state after every step, as a
+	// sequence for another recurrent layer. Otherwise only the last is output
+	ReturnSequences bool
+
+	// Truncate, if set, stops the gradient flowing back more than Truncate
+	// steps: the sequence is split into runs of that many steps, counted back
+	// from the last so any shorter run is at the start, and the hidden state
+	// is carried from one run to the next without a gradient
+	Truncate int
+
+	// Initializer sets the starting input weights and RecurrentInitializer the
+	// hidden to hidden ones. Left nil, they're uniform in +-1/sqrt(fan in) and
+	// Orthogonal. The bias starts at 0, except an LSTM's forget gate at 1
+	Initializer          Initializer
+	RecurrentInitializer Initializer
+
+	// Regularization, if set, replaces the network's for this layer
+	Regularization *Regularization
+}
+
+// cell is the unit a recurrent layer repeats at each step
+type cell int
+
+const (
+	simpleCell cell = iota
+	lstmCell
+	gruCell
+)
+
+// gates each cell computes, each the size of the hidden state
+var cellGates = map[cell]int{simpleCell: 1, lstmCell: 4, gruCell: 3}
+
+// Recurrent runs a cell along a sequence input (see SequenceShape), carrying a
+// hidden state from each step to the next, and is trained with backprop through time
+type Recurrent struct {
+	cell   cell
+	config RNNConfig
+
+	steps    int
+	features int
+
+	// inputWeights and recurrentWeights have the rows of every gate stacked in
+	// turn: i, f, g, o for an LSTM and z, r, n for a GRU
+	inputWeights     *mat.Dense
+	recurrentWeights *mat.Dense
+	bias             *mat.Dense
+
+	// kept from the forward pass for backprop, a matrix per step: the input,
+	// the hidden state after the step (with the starting zeros first), the
+	// activated gates, and for an LSTM the cell state (again from the zeros)
+	inputs []mat.Matrix
+	hidden []*mat.Dense
+	gates  []*mat.Dense
+	cells  []*mat.Dense
+
+	// from the last backward pass
+	grads []*mat.Dense
+}
+
+// NewSimpleRNN builds a layer with a tanh hidden state, h = tanh(W.x + U.h + b)
+func NewSimpleRNN(config RNNConfig) (*Recurrent, error) {
+	return newRecurrent(simpleCell, config)
+}
+
+// NewLSTM builds a long short-term memory layer, whose input, forget and output
+// gates control a cell state carried alongside the hidden state
+func NewLSTM(config RNNConfig) (*Recurrent, error) {
+	return newRecurrent(lstmCell, config)
+}
+
+// NewGRU builds a gated recurrent unit layer, whose update and reset gates
+// control how much of the hidden state each step replaces
+func NewGRU(config RNNConfig) (*Recurrent, error) {
+	return newRecurrent(gruCell, config)
+}
+
+func newRecurrent(c cell, config RNNConfig) (*Recurrent, error) {
+	if config.Units < 1 {
+		return nil, fmt.Errorf("recurrent layer has %d units", config.Units)
+	}
+	if config.Truncate < 0 {
+		return nil, fmt.Errorf("recurrent layer can't truncate to %d steps", config.Truncate)
+	}
+	return &Recurrent{cell: c, config: config}, nil
+}
+
+// Build treats the input as a sequence of one step
+func (rl *Recurrent) Build(inputSize int, rng *rand.Rand) (int, error) {
+	s, err := rl.BuildShape(SequenceShape(1, inputSize), rng)
+	return s.Size(), err
+}
+
+// BuildShape creates the weights for a sequence input, which must have one
+// channel (see SequenceShape)
+func (rl *Recurrent) BuildShape(input Shape, rng *rand.Rand) (Shape, error) {
+	if input.Channels != 1 {
+		return Shape{}, fmt.Errorf("recurrent layer needs a sequence input, not %v", input)
+	}
+	rl.steps, rl.features = input.Height, input.Width
+
+	units := rl.config.Units
+	rows := cellGates[rl.cell] * units
+
+	rl.inputWeights = mat.NewDense(rows, rl.features, nil)
+	inputInit := rl.config.Initializer
+	if inputInit == nil {
+		inputInit = fanInUniform{}
+	}
+	inputInit.Init(rl.inputWeights, rl.features, units, rng)
+
+	rl.recurrentWeights = mat.NewDense(rows, units, nil)
+	recurrentInit := rl.config.RecurrentInitializer
+	if recurrentInit == nil {
+		recurrentInit = Orthogonal{}
+	}
+	// each gate's block is initialized on its own, so each is orthogonal
+	for g := 0; g < cellGates[rl.cell]; g++ {
+		recurrentInit.Init(rl.recurrentWeights.Slice(g*units, (g+1)*units, 0, units).(*mat.Dense), units, units, rng)
+	}
+
+	rl.bias = mat.NewDense(rows, 1, nil)
+	if rl.cell == lstmCell {
+		// remember everything to start with
+		for i := units; i < 2*units; i++ {
+			rl.bias.Set(i, 0, 1)
+		}
+	}
+
+	if rl.config.ReturnSequences {
+		return SequenceShape(rl.steps, units), nil
+	}
+	return flat(units), nil
+}
+
+func (rl *Recurrent) Forward(input *mat.Dense, mode Mode, rng *rand.Rand) *mat.Dense {
+	_, samples := input.Dims()
+	units := rl.config.Units
+
+	rl.inputs = make([]mat.Matrix, rl.steps)
+	rl.hidden = []*mat.Dense{mat.NewDense(units, samples, nil)}
+	rl.gates = make([]*mat.Dense, rl.steps)
+	rl.cells = []*mat.Dense{mat.NewDense(units, samples, nil)}
+
+	for t := 0; t < rl.steps; t++ {
+		x := input.Slice(t*rl.features, (t+1)*rl.features, 0, samples)
+		rl.inputs[t] = x
+		rl.step(t, x)
+	}
+
+	if !rl.config.ReturnSequences {
+		return rl.hidden[rl.steps]
+	}
+	out := mat.NewDense(rl.steps*units, samples, nil)
+	for t := 0; t < rl.steps; t++ {
+		out.Slice(t*units, (t+1)*units, 0, samples).(*mat.Dense).Copy(rl.hidden[t+1])
+	}
+	return out
+}
+
+// step runs the cell on x, the input at step t, appending the new hidden state
+func (rl *Recurrent) step(t int, x mat.Matrix) {
+	units := rl.config.Units
+	prev := rl.hidden[t]
+
+	// every gate's weighted input, W.x + b, plus U.h for all but a GRU's candidate
+	z := AddBias(Dot(rl.inputWeights, x), rl.bias).(*mat.Dense)
+	switch rl.cell {
+	case simpleCell:
+		z.Add(z, Dot(rl.recurrentWeights, prev))
+		z.Apply(func(_, _ int, val float64) float64 { return math.Tanh(val) }, z)
+		rl.gates[t] = z
+		rl.hidden = append(rl.hidden, z)
+
+	case lstmCell:
+		z.Add(z, Dot(rl.recurrentWeights, prev))
+		z.Apply(func(i, _ int, val float64) float64 {
+			if i/units == 2 {
+				return math.Tanh(val)
+			}
+			return sigmoid(val)
+		}, z)
+		rl.gates[t] = z
+		in, forget, cand, out := rl.gate(z, 0), rl.gate(z, 1), rl.gate(z, 2), rl.gate(z, 3)
+
+		// c = f * c_prev + i * g, h = o * tanh(c)
+		c := Add(Mult(forget, rl.cells[t]), Mult(in, cand)).(*mat.Dense)
+		rl.cells = append(rl.cells, c)
+		h := Apply(func(i, j int, val float64) float64 { return out.At(i, j) * math.Tanh(val) }, c).(*mat.Dense)
+		rl.hidden = append(rl.hidden, h)
+
+	case gruCell:
+		// the update and reset gates see the whole hidden state
+		_, samples := z.Dims()
+		zr := z.Slice(0, 2*units, 0, samples).(*mat.Dense)
+		zr.Add(zr, Dot(rl.recurrentBlock(0, 2), prev))
+		zr.Apply(func(_, _ int, val float64) float64 { return sigmoid(val) }, zr)
+		update, reset := rl.gate(z, 0), rl.gate(z, 1)
+
+		// the candidate only sees what the reset gate lets through
+		n := rl.gate(z, 2)
+		n.Add(n, Dot(rl.recurrentBlock(2, 3), Mult(reset, prev)))
+		n.Apply(func(_, _ int, val float64) float64 { return math.Tanh(val) }, n)
+		rl.gates[t] = z
+
+		// h = (1 - z) * n + z * h_prev
+		h := Apply(func(i, j int, val float64) float64 {
+			u := update.At(i, j)
+			return (1-u)*val + u*prev.At(i, j)
+		}, n).(*mat.Dense)
+		rl.hidden = append(rl.hidden, h)
+	}
+}
+
+// Backward runs back through the steps from the last, passing the gradient of
+// the hidden (and cell) state back a step at a time and summing the gradients
+// of the weights, which every step shares
+func (rl *Recurrent) Backward(dOutput *mat.Dense) *mat.Dense {
+	_, samples := dOutput.Dims()
+	units := rl.config.Units
+
+	rows := cellGates[rl.cell] * units
+	dInputWeights := mat.NewDense(rows, rl.features, nil)
+	dRecurrentWeights := mat.NewDense(rows, units, nil)
+	dBias := mat.NewDense(rows, 1, nil)
+	dInput := mat.NewDense(rl.steps*rl.features, samples, nil)
+
+	// the gradient with respect to the hidden and cell states, from the step after
+	dNext := mat.NewDense(units, samples, nil)
+	dCellNext := mat.NewDense(units, samples, nil)
+
+	for t := rl.steps - 1; t >= 0; t-- {
+		dh := dNext
+		if rl.config.ReturnSequences {
+			dh = Add(dh, dOutput.Slice(t*units, (t+1)*units, 0, samples)).(*mat.Dense)
+		} else if t == rl.steps-1 {
+			dh = Add(dh, dOutput).(*mat.Dense)
+		}
+
+		prev := rl.hidden[t]
+		gates := rl.gates[t]
+
+		// dz is the gradient with respect to every gate's weighted input
+		var dz *mat.Dense
+		switch rl.cell {
+		case simpleCell:
+			dz = Apply(func(i, j int, val float64) float64 {
+				h := gates.At(i, j)
+				return val * (1 - h*h)
+			}, dh).(*mat.Dense)
+			dNext = Dot(rl.recurrentWeights.T(), dz).(*mat.Dense)
+
+		case lstmCell:
+			in, forget, cand, out := rl.gate(gates, 0), rl.gate(gates, 1), rl.gate(gates, 2), rl.gate(gates, 3)
+			c := rl.cells[t+1]
+
+			// dc = dh * o * (1 - tanh(c)^2), plus what came back from the next step
+			dc := Apply(func(i, j int, val float64) float64 {
+				tc := math.Tanh(c.At(i, j))
+				return val*out.At(i, j)*(1-tc*tc) + dCellNext.At(i, j)
+			}, dh).(*mat.Dense)
+
+			dz = mat.NewDense(4*units, samples, nil)
+			dz.Apply(func(i, j int, _ float64) float64 {
+				k := i % units
+				d := dc.At(k, j)
+				switch i / units {
+				case 0:
+					g := in.At(k, j)
+					return d * cand.At(k, j) * g * (1 - g)
+				case 1:
+					g := forget.At(k, j)
+					return d * rl.cells[t].At(k, j) * g * (1 - g)
+				case 2:
+					g := cand.At(k, j)
+					return d * in.At(k, j) * (1 - g*g)
+				}
+				g := out.At(k, j)
+				return dh.At(k, j) * math.Tanh(c.At(k, j)) * g * (1 - g)
+			}, dz)
+			dCellNext = Mult(dc, forget).(*mat.Dense)
+			dNext = Dot(rl.recurrentWeights.T(), dz).(*mat.Dense)
+
+		case gruCell:
+			update, reset, cand := rl.gate(gates, 0), rl.gate(gates, 1), rl.gate(gates, 2)
+			dz = mat.NewDense(3*units, samples, nil)
+
+			// h = (1 - z) * n + z * h_prev
+			dCand := rl.gate(dz, 2)
+			dCand.Apply(func(i, j int, val float64) float64 {
+				n := cand.At(i, j)
+				return val * (1 - update.At(i, j)) * (1 - n*n)
+			}, dh)
+			dUpdate := rl.gate(dz, 0)
+			dUpdate.Apply(func(i, j int, val float64) float64 {
+				u := update.At(i, j)
+				return val * (prev.At(i, j) - cand.At(i, j)) * u * (1 - u)
+			}, dh)
+
+			// the candidate saw reset * h_prev through its block of U
+			dResetPrev := Dot(rl.recurrentBlock(2, 3).T(), dCand)
+			dReset := rl.gate(dz, 1)
+			dReset.Apply(func(i, j int, val float64) float64 {
+				r := reset.At(i, j)
+				return val * prev.At(i, j) * r * (1 - r)
+			}, dResetPrev)
+			candBlock := dRecurrentWeights.Slice(2*units, 3*units, 0, units).(*mat.Dense)
+			candBlock.Add(candBlock, Dot(dCand, Mult(reset, prev).T()))
+
+			dNext = Apply(func(i, j int, val float64) float64 {
+				return val*update.At(i, j) + dResetPrev.At(i, j)*reset.At(i, j)
+			}, dh).(*mat.Dense)
+			dNext.Add(dNext, Dot(rl.recurrentBlock(0, 2).T(), dz.Slice(0, 2*units, 0, samples)))
+		}
+
+		x := rl.inputs[t]
+		dInputWeights.Add(dInputWeights, Dot(dz, x.T()))
+		dBias.Add(dBias, sumAlongAxis(1, dz))
+		if rl.cell == gruCell {
+			// the candidate's block was done above, against reset * h_prev
+			block := dRecurrentWeights.Slice(0, 2*units, 0, units).(*mat.Dense)
+			block.Add(block, Dot(dz.Slice(0, 2*units, 0, samples), prev.T()))
+		} else {
+			dRecurrentWeights.Add(dRecurrentWeights, Dot(dz, prev.T()))
+		}
+		dInput.Slice(t*rl.features, (t+1)*rl.features, 0, samples).(*mat.Dense).Copy(Dot(rl.inputWeights.T(), dz))
+
+		// truncated BPTT: nothing flows back into the previous run of steps.
+		// The runs end at the last step, which the output depends on most
+		if rl.config.Truncate > 0 && (rl.steps-t)%rl.config.Truncate == 0 {
+			dNext.Zero()
+			dCellNext.Zero()
+		}
+	}
+
+	rl.grads = []*mat.Dense{dInputWeights, dRecurrentWeights, dBias}
+	return dInput
+}
+
+// gate is the rows of gate g in a matrix of every gate stacked
+func (rl *Recurrent) gate(m *mat.Dense, g int) *mat.Dense {
+	units := rl.config.Units
+	_, c := m.Dims()
+	return m.Slice(g*units, (g+1)*units, 0, c).(*mat.Dense)
+}
+
+// recurrentBlock is the recurrent weights of gates from up to (not including) to
+func (rl *Recurrent) recurrentBlock(from, to int) mat.Matrix {
+	units := rl.config.Units
+	return rl.recurrentWeights.Slice(from*units, to*units, 0, units)
+}
+
+// Params are the input weights, recurrent weights and bias
+func (rl *Recurrent) Params() []*mat.Dense {
+	return []*mat.Dense{rl.inputWeights, rl.recurrentWeights, rl.bias}
+}
+
+func (rl *Recurrent) Grads() []*mat.Dense {
+	return rl.grads
+}
+
+// IsWeight is true of both sets of weights
+func (rl *Recurrent) IsWeight(k int) bool {
+	return k < 2
+}
+
+func (rl *Recurrent) Regularization() *Regularization {
+	return rl.config.Regularization
+}
+
+func (rl *Recurrent) paramNames() []string {
+	return []string{"input", "recurrent", "bias"}
+}
+
+func (rl *Recurrent) Replica() Layer {
+	return &Recurrent{
+		cell:             rl.cell,
+		config:           rl.config,
+		steps:            rl.steps,
+		features:         rl.features,
+		inputWeights:     rl.inputWeights,
+		recurrentWeights: rl.recurrentWeights,
+		bias:             rl.bias,
+	}
+}
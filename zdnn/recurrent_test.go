@@ -0,0 +1,75 @@
+package zdnn
+
+import (
+	"math/rand"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// reachedSteps runs a simple RNN of 5 steps forward and dOutput back, and
+// reports which steps' inputs got any gradient
+func reachedSteps(t *testing.T, config RNNConfig, dOutput func(units int) *mat.Dense) []bool {
+	t.Helper()
+	config.Units = 2
+	rl, err := NewSimpleRNN(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const steps, features = 5, 2
+	if _, err := rl.BuildShape(SequenceShape(steps, features), rand.New(rand.NewSource(1))); err != nil {
+		t.Fatal(err)
+	}
+	input := mat.NewDense(steps*features, 1, nil)
+	for i := 0; i < steps*features; i++ {
+		input.Set(i, 0, float64(i%3)-1)
+	}
+	rl.Forward(input, Training, nil)
+	dInput := rl.Backward(dOutput(config.Units))
+
+	reached := make([]bool, steps)
+	for s := range reached {
+		for f := 0; f < features; f++ {
+			if dInput.At(s*features+f, 0) != 0 {
+				reached[s] = true
+			}
+		}
+	}
+	return reached
+}
+
+func checkReached(t *testing.T, name string, got, want []bool) {
+	t.Helper()
+	for s := range want {
+		if got[s] != want[s] {
+			t.Errorf("%s: the gradient reached steps %v, want %v", name, got, want)
+			return
+		}
+	}
+}
+
+func TestRecurrentTruncate(t *testing.T) {
+	last := func(units int) *mat.Dense {
+		return mat.NewDense(units, 1, []float64{1, 1})
+	}
+	checkReached(t, "no truncation", reachedSteps(t, RNNConfig{}, last), []bool{true, true, true, true, true})
+
+	// runs of 2 counted back from the last step, [3 4] [1 2] [0], so the
+	// last hidden state's gradient gets 2 steps back, not just 1
+	checkReached(t, "truncate 2", reachedSteps(t, RNNConfig{Truncate: 2}, last), []bool{false, false, false, true, true})
+	checkReached(t, "truncate 3", reachedSteps(t, RNNConfig{Truncate: 3}, last), []bool{false, false, true, true, true})
+
+	// every step's output only gets back to the start of its own run
+	atStep := func(step int) func(units int) *mat.Dense {
+		return func(units int) *mat.Dense {
+			d := mat.NewDense(5*units, 1, nil)
+			d.Set(step*units, 0, 1)
+			return d
+		}
+	}
+	sequences := RNNConfig{ReturnSequences: true, Truncate: 2}
+	checkReached(t, "sequences, output 2", reachedSteps(t, sequences, atStep(2)), []bool{false, true, true, false, false})
+	checkReached(t, "sequences, output 0", reachedSteps(t, sequences, atStep(0)), []bool{true, false, false, false, false})
+	sequences.Truncate = 0
+	checkReached(t, "sequences, output 2, no truncation", reachedSteps(t, sequences, atStep(2)), []bool{true, true, true, false, false})
+}
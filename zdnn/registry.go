@@ -0,0 +1,123 @@
+package zdnn
+
+import (
+	"fmt"
+	"sync"
+)
+
+// ActivationFactory builds a fresh activation. It's called once per layer, so
+// activations with params of their own don't share them between layers
+type ActivationFactory func() IActivation
+
+// LossFactory builds a fresh loss
+type LossFactory func() ILoss
+
+var (
+	registryMu  sync.RWMutex
+	activations = make(map[string]ActivationFactory)
+	losses      = make(map[string]LossFactory)
+)
+
+var activationNames = map[Activation]string{
+	Sigmoid:   "sigmoid",
+	ReLU:      "relu",
+	Softmax:   "softmax",
+	Tanh:      "tanh",
+	LeakyReLU: "leaky_relu",
+	PReLU:     "prelu",
+	ELU:       "elu",
+	SELU:      "selu",
+	GELU:      "gelu",
+	Swish:     "swish",
+	Softplus:  "softplus",
+	Linear:    "linear",
+}
+
+var lossNames = map[Loss]string{
+	CrossEntropy:       "cross_entropy",
+	MeanSquared:        "mean_squared",
+	BinaryCrossEntropy: "binary_cross_entropy",
+}
+
+// the built in activations and losses are registered under their String names
+func init() {
+	for opt, name := range activationNames {
+		opt := opt
+		RegisterActivation(name, func() IActivation {
+			act, _ := NewActivation(opt)
+			return act
+		})
+	}
+	for opt, name := range lossNames {
+		opt := opt
+		RegisterLoss(name, func() ILoss {
+			loss, _ := NewLoss(opt)
+			return loss
+		})
+	}
+}
+
+func (a Activation) String() string {
+	if name, ok := activationNames[a]; ok {
+		return name
+	}
+	return fmt.Sprintf("Activation(%d)", int(a))
+}
+
+func (l Loss) String() string {
+	if name, ok := lossNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("Loss(%d)", int(l))
+}
+
+// RegisterActivation makes a custom activation available to
+// LayerConfig.ActivationName, and to Load for models saved with it. Like
+// gob.Register it's meant for init time, and panics if the name is taken
+func RegisterActivation(name string, factory ActivationFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if factory == nil {
+		panic("zdnn: RegisterActivation factory is nil")
+	}
+	if _, dup := activations[name]; dup {
+		panic("zdnn: RegisterActivation called twice for " + name)
+	}
+	activations[name] = factory
+}
+
+// RegisterLoss makes a custom loss available to NNConfig.LossName, and to Load
+// for models saved with it. It panics if the name is taken
+func RegisterLoss(name string, factory LossFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if factory == nil {
+		panic("zdnn: RegisterLoss factory is nil")
+	}
+	if _, dup := losses[name]; dup {
+		panic("zdnn: RegisterLoss called twice for " + name)
+	}
+	losses[name] = factory
+}
+
+// ActivationByName builds the activation registered as name
+func ActivationByName(name string) (IActivation, error) {
+	registryMu.RLock()
+	factory, ok := activations[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("no activation registered as %q", name)
+	}
+	return factory(), nil
+}
+
+// LossByName builds the loss registered as name
+func LossByName(name string) (ILoss, error) {
+	registryMu.RLock()
+	factory, ok := losses[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("no loss registered as %q", name)
+	}
+	return factory(), nil
+}
@@ -0,0 +1,96 @@
+package zdnn
+
+import (
+	"math"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Penalty discourages large values in a param. L1 adds L1 * sum|w| to the loss
+// and L2 adds L2/2 * sum w^2 (set both for elastic net), and their gradients
+// join the backprop gradient. Decay is decoupled weight decay: after each
+// optimizer step the param shrinks by rate * Decay, whatever the optimizer did
+type Penalty struct {
+	L1    float64
+	L2    float64
+	Decay float64
+}
+
+// Regularization sets the penalties for weights and biases separately
+type Regularization struct {
+	Weights Penalty
+	Bias    Penalty
+}
+
+// penalties lines up with the network's params (each layer's in turn), giving
+// the penalty for each. Only WeightedLayers are penalized, and those with their
+// own Regularization override the network's
+func (nn *NeuralNetwork) penalties() []Penalty {
+	var pens []Penalty
+	for _, layer := range nn.layers {
+		wl, ok := layer.(WeightedLayer)
+		if !ok {
+			pens = append(pens, make([]Penalty, len(layer.Params()))...)
+			continue
+		}
+
+		reg := nn.config.Regularization
+		if r := wl.Regularization(); r != nil {
+			reg = *r
+		}
+		for k := range layer.Params() {
+			if wl.IsWeight(k) {
+				pens = append(pens, reg.Weights)
+			} else {
+				pens = append(pens, reg.Bias)
+			}
+		}
+	}
+	return pens
+}
+
+// isWeight reports whether the layer's kth param is a weight rather than a bias
+func isWeight(layer Layer, k int) bool {
+	wl, ok := layer.(WeightedLayer)
+	return ok && wl.IsWeight(k)
+}
+
+// penalize adds the L1 and L2 gradients to params and returns what they add to the loss
+func penalize(params []Param, pens []Penalty) float64 {
+	loss := 0.0
+	for k, p := range params {
+		pen := pens[k]
+		if pen.L1 == 0 && pen.L2 == 0 {
+			continue
+		}
+		// sum|w| and sum w^2 (the Frobenius norm squared)
+		abs := mat.Sum(Apply(func(_, _ int, val float64) float64 { return math.Abs(val) }, p.Value))
+		sq := math.Pow(mat.Norm(p.Value, 2), 2)
+		loss += pen.L1*abs + pen.L2/2*sq
+
+		grad := Apply(func(i, j int, val float64) float64 {
+			return pen.L1*sign(val) + pen.L2*val
+		}, p.Value)
+		p.Grad.Add(p.Grad, grad)
+	}
+	return loss
+}
+
+// decay shrinks params with a decoupled decay, after the optimizer has stepped
+func decay(params []Param, pens []Penalty, rate float64) {
+	for k, p := range params {
+		if pens[k].Decay != 0 {
+			p.Value.Scale(1-rate*pens[k].Decay, p.Value)
+		}
+	}
+}
+
+func sign(num float64) float64 {
+	switch {
+	case num > 0:
+		return 1.0
+	case num < 0:
+		return -1.0
+	}
+	return 0.0
+}
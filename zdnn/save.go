@@ -0,0 +1,387 @@
+package zdnn
+
+import (
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"io"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// model files start with this magic and a big endian uint16 format version,
+// followed by the gob encoded savedModel
+const (
+	modelMagic   = "ZDNN"
+	modelVersion = 1
+)
+
+// savedModel is everything needed to rebuild a network without knowing its shape
+type savedModel struct {
+	InputNeurons   int
+	InputShape     Shape
+	NumEpochs      int
+	LearningRate   float64
+	LossFunc       Loss
+	LossName       string
+	BatchSize      int
+	Seed           int64
+	RandomSeed     bool
+	Regularization Regularization
+	Layers         []savedLayer
+}
+
+// savedLayer is a layer's config with its trained weights and bias, plus any
+// params the activation learned. Kind is empty for a dense layer, "activation"
+// for an activation layer, "dropout" for a dropout layer, which has no
+// weights, "batch_norm" or "layer_norm" for a norm layer, whose gamma, beta
+// and running statistics go in Norm, "conv2d" for a convolution, whose kernels
+// go in Weights, "max_pool2d" or "avg_pool2d" for a pooling layer, whose
+// window goes in Kernel, "flatten" or "reshape", or "simple_rnn", "lstm" or
+// "gru" for a recurrent layer, whose units go in Neurons and weights in Params.
+// Regularization is the layer's own, nil if it uses the network's
+type savedLayer struct {
+	Kind             string
+	Dropout          float64
+	Neurons          int
+	Activation       Activation
+	ActivationName   string
+	Weights          savedMatrix
+	Bias             savedMatrix
+	ActivationParams []savedMatrix
+	Momentum         float64
+	Epsilon          float64
+	Norm             []savedMatrix
+	Filters          int
+	Kernel           [2]int
+	Stride           [2]int
+	Padding          [2]int
+	Shape            Shape
+	ReturnSequences  bool
+	Truncate         int
+	Params           []savedMatrix
+	Regularization   *Regularization
+}
+
+type savedMatrix struct {
+	Rows int
+	Cols int
+	Data []float64
+}
+
+// Save writes the network's config, layers, weights and biases to w
+func (nn *NeuralNetwork) Save(w io.Writer) error {
+	nn.mu.Lock()
+	defer nn.mu.Unlock()
+
+	model := savedModel{
+		InputNeurons:   nn.config.InputNeurons,
+		InputShape:     nn.config.InputShape,
+		NumEpochs:      nn.config.NumEpochs,
+		LearningRate:   nn.config.LearningRate,
+		LossFunc:       nn.config.LossFunc,
+		LossName:       nn.lossName(),
+		BatchSize:      nn.config.BatchSize,
+		Seed:           nn.config.Seed,
+		RandomSeed:     nn.config.RandomSeed,
+		Regularization: nn.config.Regularization,
+	}
+	for i, layer := range nn.layers {
+		sv, ok := layer.(savable)
+		if !ok {
+			return fmt.Errorf("layer %d (%T) can't be saved", i, layer)
+		}
+		model.Layers = append(model.Layers, sv.save())
+	}
+
+	if _, err := io.WriteString(w, modelMagic); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.BigEndian, uint16(modelVersion)); err != nil {
+		return err
+	}
+	return gob.NewEncoder(w).Encode(model)
+}
+
+// Load reads a network written by Save, ready for Predict or more training
+func Load(r io.Reader) (*NeuralNetwork, error) {
+	magic := make([]byte, len(modelMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return nil, fmt.Errorf("reading model header: %v", err)
+	}
+	if string(magic) != modelMagic {
+		return nil, fmt.Errorf("not a zdnn model file")
+	}
+	var version uint16
+	if err := binary.Read(r, binary.BigEndian, &version); err != nil {
+		return nil, fmt.Errorf("reading model version: %v", err)
+	}
+	if version != modelVersion {
+		return nil, fmt.Errorf("unsupported model version %d (want %d)", version, modelVersion)
+	}
+
+	var model savedModel
+	if err := gob.NewDecoder(r).Decode(&model); err != nil {
+		return nil, fmt.Errorf("decoding model: %v", err)
+	}
+	if len(model.Layers) == 0 {
+		return nil, fmt.Errorf("model has no layers")
+	}
+
+	layers := make([]Layer, len(model.Layers))
+	for i, sl := range model.Layers {
+		layer, err := newSavedLayer(sl)
+		if err != nil {
+			return nil, fmt.Errorf("layer %d: %v", i, err)
+		}
+		layers[i] = layer
+	}
+	nn, err := NewNetwork(NNConfig{
+		InputNeurons:   model.InputNeurons,
+		InputShape:     model.InputShape,
+		HiddenLayers:   layers[:len(layers)-1],
+		OutputLayer:    layers[len(layers)-1],
+		NumEpochs:      model.NumEpochs,
+		LearningRate:   model.LearningRate,
+		LossFunc:       model.LossFunc,
+		LossName:       model.LossName,
+		BatchSize:      model.BatchSize,
+		Seed:           model.Seed,
+		RandomSeed:     model.RandomSeed,
+		Regularization: model.Regularization,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// swap the random init for the saved values, checking they fit the layer
+	for i, layer := range nn.layers {
+		if err := layer.(savable).restore(model.Layers[i]); err != nil {
+			return nil, fmt.Errorf("layer %d %v", i, err)
+		}
+	}
+
+	return nn, nil
+}
+
+// savable is implemented by the built in layers so Save can write them out.
+// restore puts the saved values back once Load has built the layer
+type savable interface {
+	save() savedLayer
+	restore(sl savedLayer) error
+}
+
+// newSavedLayer builds the (not yet built) layer sl was saved from
+func newSavedLayer(sl savedLayer) (Layer, error) {
+	switch sl.Kind {
+	case "":
+		// custom activations come back through the registry by name
+		return NewLayer(LayerConfig{
+			Neurons:        sl.Neurons,
+			Activation:     sl.Activation,
+			ActivationName: sl.ActivationName,
+			Regularization: sl.Regularization,
+			Dropout:        sl.Dropout,
+		})
+	case "activation":
+		return NewActivationLayer(sl.ActivationName)
+	case "dropout":
+		return NewDropout(sl.Dropout)
+	case "batch_norm":
+		return NewBatchNorm(NormConfig{Momentum: sl.Momentum, Epsilon: sl.Epsilon})
+	case "layer_norm":
+		return NewLayerNorm(NormConfig{Momentum: sl.Momentum, Epsilon: sl.Epsilon})
+	case "conv2d":
+		return NewConv2D(Conv2DConfig{Filters: sl.Filters, Kernel: sl.Kernel, Stride: sl.Stride, Padding: sl.Padding, Regularization: sl.Regularization})
+	case "max_pool2d":
+		return NewMaxPool2D(PoolConfig{Size: sl.Kernel, Stride: sl.Stride})
+	case "avg_pool2d":
+		return NewAvgPool2D(PoolConfig{Size: sl.Kernel, Stride: sl.Stride})
+	case "simple_rnn", "lstm", "gru":
+		config := RNNConfig{Units: sl.Neurons, ReturnSequences: sl.ReturnSequences, Truncate: sl.Truncate, Regularization: sl.Regularization}
+		return newRecurrent(cellNames[sl.Kind], config)
+	case "flatten":
+		return NewFlatten(), nil
+	case "reshape":
+		return NewReshape(sl.Shape)
+	}
+	return nil, fmt.Errorf("unknown layer kind %q", sl.Kind)
+}
+
+func (nl *NeuronLayer) save() savedLayer {
+	return savedLayer{
+		Dropout:          nl.config.Dropout,
+		Neurons:          nl.config.Neurons,
+		Activation:       nl.config.Activation,
+		ActivationName:   nl.activationName(),
+		Weights:          saveMatrix(nl.weights),
+		Bias:             saveMatrix(nl.bias),
+		ActivationParams: saveActivationParams(nl.activation),
+		Regularization:   nl.config.Regularization,
+	}
+}
+
+func (nl *NeuronLayer) restore(sl savedLayer) error {
+	weights, err := loadMatrix(sl.Weights, nl.weights)
+	if err != nil {
+		return fmt.Errorf("weights: %v", err)
+	}
+	bias, err := loadMatrix(sl.Bias, nl.bias)
+	if err != nil {
+		return fmt.Errorf("bias: %v", err)
+	}
+	nl.Update(weights, bias)
+	return restoreActivationParams(nl.activation, sl.ActivationParams)
+}
+
+func (al *ActivationLayer) save() savedLayer {
+	return savedLayer{Kind: "activation", ActivationName: al.name, ActivationParams: saveActivationParams(al.activation)}
+}
+
+func (al *ActivationLayer) restore(sl savedLayer) error {
+	return restoreActivationParams(al.activation, sl.ActivationParams)
+}
+
+func (dl *DropoutLayer) save() savedLayer {
+	return savedLayer{Kind: "dropout", Dropout: dl.rate}
+}
+
+func (dl *DropoutLayer) restore(sl savedLayer) error {
+	return nil
+}
+
+func (n *NormLayer) save() savedLayer {
+	sl := savedLayer{Kind: "layer_norm", Momentum: n.momentum, Epsilon: n.epsilon}
+	if n.batch {
+		sl.Kind = "batch_norm"
+	}
+	for _, m := range n.state() {
+		sl.Norm = append(sl.Norm, saveMatrix(m))
+	}
+	return sl
+}
+
+func (n *NormLayer) restore(sl savedLayer) error {
+	return restoreMatrices("norm value", sl.Norm, n.state())
+}
+
+func (cl *Conv2D) save() savedLayer {
+	return savedLayer{
+		Kind:           "conv2d",
+		Filters:        cl.config.Filters,
+		Kernel:         cl.config.Kernel,
+		Stride:         cl.stride,
+		Padding:        cl.config.Padding,
+		Weights:        saveMatrix(cl.kernels),
+		Bias:           saveMatrix(cl.bias),
+		Regularization: cl.config.Regularization,
+	}
+}
+
+func (cl *Conv2D) restore(sl savedLayer) error {
+	return restoreMatrices("conv param", []savedMatrix{sl.Weights, sl.Bias}, cl.Params())
+}
+
+func (pl *Pool2D) save() savedLayer {
+	sl := savedLayer{Kind: "avg_pool2d", Kernel: pl.size, Stride: pl.stride}
+	if pl.max {
+		sl.Kind = "max_pool2d"
+	}
+	return sl
+}
+
+func (pl *Pool2D) restore(sl savedLayer) error {
+	return nil
+}
+
+func (f *Flatten) save() savedLayer {
+	return savedLayer{Kind: "flatten"}
+}
+
+func (f *Flatten) restore(sl savedLayer) error {
+	return nil
+}
+
+func (r *Reshape) save() savedLayer {
+	return savedLayer{Kind: "reshape", Shape: r.shape}
+}
+
+func (r *Reshape) restore(sl savedLayer) error {
+	return nil
+}
+
+// cellNames are the kinds recurrent layers are saved as
+var cellNames = map[string]cell{"simple_rnn": simpleCell, "lstm": lstmCell, "gru": gruCell}
+
+func (rl *Recurrent) save() savedLayer {
+	sl := savedLayer{
+		Neurons:         rl.config.Units,
+		ReturnSequences: rl.config.ReturnSequences,
+		Truncate:        rl.config.Truncate,
+		Regularization:  rl.config.Regularization,
+	}
+	for name, c := range cellNames {
+		if c == rl.cell {
+			sl.Kind = name
+		}
+	}
+	for _, p := range rl.Params() {
+		sl.Params = append(sl.Params, saveMatrix(p))
+	}
+	return sl
+}
+
+func (rl *Recurrent) restore(sl savedLayer) error {
+	return restoreMatrices("recurrent param", sl.Params, rl.Params())
+}
+
+func saveActivationParams(act IActivation) []savedMatrix {
+	var saved []savedMatrix
+	if pa, ok := act.(ParamActivation); ok {
+		for _, p := range pa.Params() {
+			saved = append(saved, saveMatrix(p))
+		}
+	}
+	return saved
+}
+
+func restoreActivationParams(act IActivation, saved []savedMatrix) error {
+	var params []*mat.Dense
+	if pa, ok := act.(ParamActivation); ok {
+		params = pa.Params()
+	}
+	return restoreMatrices("activation param", saved, params)
+}
+
+// restoreMatrices copies the saved values into each of ms in place
+func restoreMatrices(what string, saved []savedMatrix, ms []*mat.Dense) error {
+	if len(saved) != len(ms) {
+		return fmt.Errorf("has %d %ss, expected %d", len(saved), what, len(ms))
+	}
+	for k, m := range ms {
+		loaded, err := loadMatrix(saved[k], m)
+		if err != nil {
+			return fmt.Errorf("%s %d: %v", what, k, err)
+		}
+		m.Copy(loaded)
+	}
+	return nil
+}
+
+func saveMatrix(m *mat.Dense) savedMatrix {
+	r, c := m.Dims()
+	data := make([]float64, 0, r*c)
+	for i := 0; i < r; i++ {
+		data = append(data, m.RawRowView(i)...)
+	}
+	return savedMatrix{Rows: r, Cols: c, Data: data}
+}
+
+// loadMatrix rebuilds a saved matrix, which must have the same dims as like
+func loadMatrix(sm savedMatrix, like *mat.Dense) (*mat.Dense, error) {
+	r, c := like.Dims()
+	if sm.Rows != r || sm.Cols != c || len(sm.Data) != r*c {
+		return nil, fmt.Errorf("saved as %dx%d with %d values, expected %dx%d", sm.Rows, sm.Cols, len(sm.Data), r, c)
+	}
+	return mat.NewDense(r, c, sm.Data), nil
+}
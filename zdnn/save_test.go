@@ -0,0 +1,145 @@
+package zdnn
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"testing"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestSaveRegularization(t *testing.T) {
+	dense := &Regularization{Weights: Penalty{L2: .01}, Bias: Penalty{L1: .002}}
+	conv := &Regularization{Weights: Penalty{Decay: .05}}
+	// an empty override still stops the network's applying to the layer
+	rnn := &Regularization{}
+
+	layers := []Layer{}
+	for _, build := range []func() (Layer, error){
+		func() (Layer, error) {
+			return NewConv2D(Conv2DConfig{Filters: 2, Kernel: [2]int{2, 2}, Regularization: conv})
+		},
+		func() (Layer, error) { return NewReshape(SequenceShape(4, 2)) },
+		func() (Layer, error) { return NewSimpleRNN(RNNConfig{Units: 3, Regularization: rnn}) },
+		func() (Layer, error) {
+			return NewLayer(LayerConfig{Neurons: 2, Activation: Softmax, Regularization: dense})
+		},
+	} {
+		layer, err := build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		layers = append(layers, layer)
+	}
+	config := NNConfig{
+		InputShape:     Shape{Channels: 1, Height: 3, Width: 3},
+		HiddenLayers:   layers[:len(layers)-1],
+		OutputLayer:    layers[len(layers)-1],
+		LossFunc:       CrossEntropy,
+		LearningRate:   .1,
+		Regularization: Regularization{Weights: Penalty{L1: .1, L2: .2}, Bias: Penalty{Decay: .3}},
+	}
+	nn, err := NewNetwork(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := nn.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.config.Regularization != config.Regularization {
+		t.Errorf("network regularization loaded as %+v, saved %+v", loaded.config.Regularization, config.Regularization)
+	}
+	want := []*Regularization{conv, nil, rnn, dense}
+	for i, layer := range loaded.layers {
+		var got *Regularization
+		if wl, ok := layer.(WeightedLayer); ok {
+			got = wl.Regularization()
+		}
+		if !reflect.DeepEqual(got, want[i]) {
+			t.Errorf("layer %d regularization loaded as %+v, saved %+v", i, got, want[i])
+		}
+	}
+	if !reflect.DeepEqual(loaded.penalties(), nn.penalties()) {
+		t.Errorf("loaded penalties %+v, saved %+v", loaded.penalties(), nn.penalties())
+	}
+}
+
+// softsign is registered for TestSaveRoundTrip, to save and load a network
+// using an activation zdnn doesn't know
+type softsign struct{}
+
+func (softsign) PrimeInput() PrimeInput { return PreActivation }
+
+func (softsign) Apply(m mat.Matrix) mat.Matrix {
+	return Apply(func(_, _ int, val float64) float64 { return val / (1 + math.Abs(val)) }, m)
+}
+
+func (softsign) ApplyPrime(m mat.Matrix) mat.Matrix {
+	return Apply(func(_, _ int, val float64) float64 { return 1 / ((1 + math.Abs(val)) * (1 + math.Abs(val))) }, m)
+}
+
+func init() {
+	RegisterActivation("softsign", func() IActivation { return softsign{} })
+}
+
+func TestSaveRoundTrip(t *testing.T) {
+	dense, err := NewLayer(LayerConfig{Neurons: 4, ActivationName: "softsign"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	norm, err := NewBatchNorm(NormConfig{Epsilon: 1e-5, Momentum: .5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	act, err := NewActivationLayer("softsign")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nn := gradNet(t, flat(3), []Layer{dense, norm, act}, LayerConfig{Neurons: 2, Activation: Softmax}, CrossEntropy)
+
+	// training moves the running statistics off their starting 0 and 1
+	for step := 0; step < 5; step++ {
+		if _, err := nn.TrainBatch(gradInputs, gradOneHot); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if mat.Equal(norm.runningMean, mat.NewDense(4, 1, nil)) {
+		t.Fatalf("training left the running mean at zero")
+	}
+
+	var buf bytes.Buffer
+	if err := nn.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := loaded.layers[1].(*NormLayer); !mat.Equal(got.runningMean, norm.runningMean) || !mat.Equal(got.runningVar, norm.runningVar) {
+		t.Errorf("running statistics loaded as %v and %v, saved %v and %v",
+			mat.Formatted(got.runningMean.T()), mat.Formatted(got.runningVar.T()),
+			mat.Formatted(norm.runningMean.T()), mat.Formatted(norm.runningVar.T()))
+	}
+	for _, input := range [][]float64{gradInputs[0], gradInputs[1], {3, -2, 0}} {
+		want, err := nn.Predict(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := loaded.Predict(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !mat.Equal(got, want) {
+			t.Errorf("loaded network predicted %v for %v, saved one %v", mat.Formatted(got.T()), input, mat.Formatted(want.T()))
+		}
+	}
+}
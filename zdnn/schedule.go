@@ -0,0 +1,265 @@
+package zdnn
+
+import (
+	"fmt"
+	"math"
+)
+
+// Scheduler picks the learning rate for every training step. step counts
+// batches across all epochs, both start at 0.
+//
+// The built in schedulers use their fields as they are, with constructors for
+// the usual settings. NewNetwork rejects any that would make the rate zero,
+// negative or NaN
+type Scheduler interface {
+	Rate(base float64, epoch, step int) float64
+}
+
+// LossObserver is a scheduler that adapts to how training is going. Train calls
+// Observe at the end of every epoch with the validation loss, or with the
+// training loss when there is no validation set
+type LossObserver interface {
+	Observe(epoch int, loss float64)
+}
+
+// StepDecay multiplies the rate by Gamma every StepSize epochs, or never if
+// StepSize is 0
+type StepDecay struct {
+	StepSize int
+	// Gamma is the factor applied each time (0.1 from NewStepDecay)
+	Gamma float64
+}
+
+// NewStepDecay builds a StepDecay cutting the rate tenfold every stepSize epochs
+func NewStepDecay(stepSize int) *StepDecay {
+	return &StepDecay{StepSize: stepSize, Gamma: 0.1}
+}
+
+// ExponentialDecay multiplies the rate by Gamma every epoch
+type ExponentialDecay struct {
+	// Gamma is the factor applied each epoch (0.95 from NewExponentialDecay)
+	Gamma float64
+}
+
+// NewExponentialDecay builds an ExponentialDecay losing 5% of the rate every epoch
+func NewExponentialDecay() *ExponentialDecay {
+	return &ExponentialDecay{Gamma: 0.95}
+}
+
+// CosineAnnealing follows a half cosine from the base rate down to MinRate over
+// Period epochs, then restarts, each cycle Mult times longer than the last
+// (SGDR). It stays at the base rate if Period is 0
+type CosineAnnealing struct {
+	Period int
+	// Mult grows each cycle (1 from NewCosineAnnealing, every cycle the same length)
+	Mult    int
+	MinRate float64
+}
+
+// NewCosineAnnealing builds a CosineAnnealing restarting every period epochs
+// and annealing down to 0
+func NewCosineAnnealing(period int) *CosineAnnealing {
+	return &CosineAnnealing{Period: period, Mult: 1}
+}
+
+// LinearWarmup ramps the rate up from near zero over the first Steps batches,
+// then hands over to After (or the base rate if After is nil)
+type LinearWarmup struct {
+	Steps int
+	After Scheduler
+}
+
+// OneCycle warms up from MaxRate / DivFactor to MaxRate over the first PctStart
+// of TotalSteps, then anneals down to MaxRate / (DivFactor * FinalDivFactor).
+// It ignores the base rate
+type OneCycle struct {
+	// MaxRate is the peak
+	MaxRate    float64
+	TotalSteps int
+	// PctStart is the share of steps spent warming up (0.3 from NewOneCycle)
+	PctStart float64
+	// DivFactor sets the starting rate (25 from NewOneCycle)
+	DivFactor float64
+	// FinalDivFactor sets the final rate (1e4 from NewOneCycle)
+	FinalDivFactor float64
+}
+
+// NewOneCycle builds a OneCycle over totalSteps peaking at maxRate
+func NewOneCycle(maxRate float64, totalSteps int) *OneCycle {
+	return &OneCycle{MaxRate: maxRate, TotalSteps: totalSteps, PctStart: 0.3, DivFactor: 25, FinalDivFactor: 1e4}
+}
+
+// ReduceOnPlateau multiplies the rate by Factor once the observed loss hasn't
+// improved by more than Threshold (relative) for Patience epochs
+type ReduceOnPlateau struct {
+	// Factor is applied on each plateau (0.1 from NewReduceOnPlateau)
+	Factor float64
+	// Patience is the number of epochs without improvement to wait (10 from
+	// NewReduceOnPlateau)
+	Patience int
+	// Threshold is the relative improvement that counts (1e-4 from NewReduceOnPlateau)
+	Threshold float64
+	MinRate   float64
+
+	// cuts is how many plateaus the rate has been cut for
+	cuts int
+	best float64
+	bad  int
+	seen bool
+}
+
+// NewReduceOnPlateau builds a ReduceOnPlateau cutting the rate tenfold after
+// 10 epochs without improvement
+func NewReduceOnPlateau() *ReduceOnPlateau {
+	return &ReduceOnPlateau{Factor: 0.1, Patience: 10, Threshold: 1e-4}
+}
+
+func (s *StepDecay) Rate(base float64, epoch, step int) float64 {
+	if s.StepSize <= 0 {
+		return base
+	}
+	return base * math.Pow(s.Gamma, float64(epoch/s.StepSize))
+}
+
+func (s *ExponentialDecay) Rate(base float64, epoch, step int) float64 {
+	return base * math.Pow(s.Gamma, float64(epoch))
+}
+
+func (s *CosineAnnealing) Rate(base float64, epoch, step int) float64 {
+	if s.Period <= 0 {
+		return base
+	}
+	// find where in the current cycle this epoch is
+	period, cur := s.Period, epoch
+	for cur >= period {
+		cur -= period
+		period *= s.Mult
+	}
+	return s.MinRate + (base-s.MinRate)*(1+math.Cos(math.Pi*float64(cur)/float64(period)))/2
+}
+
+func (s *LinearWarmup) Rate(base float64, epoch, step int) float64 {
+	if step < s.Steps {
+		return base * float64(step+1) / float64(s.Steps)
+	}
+	if s.After != nil {
+		return s.After.Rate(base, epoch, step)
+	}
+	return base
+}
+
+// Observe passes the loss on to the wrapped scheduler if it wants it
+func (s *LinearWarmup) Observe(epoch int, loss float64) {
+	if o, ok := s.After.(LossObserver); ok {
+		o.Observe(epoch, loss)
+	}
+}
+
+func (s *OneCycle) Rate(base float64, epoch, step int) float64 {
+	max := s.MaxRate
+	if s.TotalSteps <= 0 {
+		return max
+	}
+	start := max / s.DivFactor
+	end := start / s.FinalDivFactor
+	warmup := s.PctStart * float64(s.TotalSteps)
+
+	pos := float64(step)
+	if pos < warmup {
+		return cosineBetween(start, max, pos/warmup)
+	}
+	rest := float64(s.TotalSteps) - warmup
+	return cosineBetween(max, end, math.Min((pos-warmup)/rest, 1))
+}
+
+// cosineBetween eases from a to b as pct goes from 0 to 1
+func cosineBetween(a, b, pct float64) float64 {
+	return b + (a-b)*(1+math.Cos(math.Pi*pct))/2
+}
+
+func (s *ReduceOnPlateau) Rate(base float64, epoch, step int) float64 {
+	return math.Max(base*math.Pow(s.Factor, float64(s.cuts)), s.MinRate)
+}
+
+func (s *ReduceOnPlateau) Observe(epoch int, loss float64) {
+	if !s.seen || loss < s.best*(1-s.Threshold) {
+		s.best, s.bad, s.seen = loss, 0, true
+		return
+	}
+	s.bad++
+	if s.bad >= s.Patience {
+		s.cuts++
+		s.bad = 0
+	}
+}
+
+// checkFactor errors unless a factor the rate is multiplied by keeps it positive
+func checkFactor(what string, val float64) error {
+	if !(val > 0) {
+		return fmt.Errorf("%s %v isn't positive", what, val)
+	}
+	return nil
+}
+
+func (s *StepDecay) validate() error {
+	if s.StepSize < 0 {
+		return fmt.Errorf("step decay step size %d is negative", s.StepSize)
+	}
+	return checkFactor("step decay gamma", s.Gamma)
+}
+
+func (s *ExponentialDecay) validate() error {
+	return checkFactor("exponential decay gamma", s.Gamma)
+}
+
+func (s *CosineAnnealing) validate() error {
+	if s.Period < 0 {
+		return fmt.Errorf("cosine annealing period %d is negative", s.Period)
+	}
+	if s.Mult < 1 {
+		return fmt.Errorf("cosine annealing mult %d is less than 1", s.Mult)
+	}
+	if s.MinRate < 0 {
+		return fmt.Errorf("cosine annealing min rate %v is negative", s.MinRate)
+	}
+	return nil
+}
+
+func (s *LinearWarmup) validate() error {
+	if s.Steps < 0 {
+		return fmt.Errorf("linear warmup steps %d is negative", s.Steps)
+	}
+	return validate(s.After)
+}
+
+func (s *OneCycle) validate() error {
+	if err := checkFactor("one cycle max rate", s.MaxRate); err != nil {
+		return err
+	}
+	if s.TotalSteps < 0 {
+		return fmt.Errorf("one cycle total steps %d is negative", s.TotalSteps)
+	}
+	if !(s.PctStart >= 0 && s.PctStart < 1) {
+		return fmt.Errorf("one cycle pct start %v is outside [0, 1)", s.PctStart)
+	}
+	if err := checkFactor("one cycle div factor", s.DivFactor); err != nil {
+		return err
+	}
+	return checkFactor("one cycle final div factor", s.FinalDivFactor)
+}
+
+func (s *ReduceOnPlateau) validate() error {
+	if err := checkFactor("reduce on plateau factor", s.Factor); err != nil {
+		return err
+	}
+	if s.Patience < 0 {
+		return fmt.Errorf("reduce on plateau patience %d is negative", s.Patience)
+	}
+	if s.Threshold < 0 {
+		return fmt.Errorf("reduce on plateau threshold %v is negative", s.Threshold)
+	}
+	if s.MinRate < 0 {
+		return fmt.Errorf("reduce on plateau min rate %v is negative", s.MinRate)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package zdnn
+
+import (
+	"math"
+	"testing"
+)
+
+// rates are the rates s gives for each epoch in turn, one step per epoch
+func rates(s Scheduler, base float64, epochs int) []float64 {
+	var rs []float64
+	for e := 0; e < epochs; e++ {
+		rs = append(rs, s.Rate(base, e, e))
+	}
+	return rs
+}
+
+func checkRates(t *testing.T, name string, got, want []float64) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%s gave %d rates, want %d", name, len(got), len(want))
+	}
+	for i := range want {
+		if math.Abs(got[i]-want[i]) > 1e-12 {
+			t.Errorf("%s gave rates %v, want %v", name, got, want)
+			return
+		}
+	}
+}
+
+func TestScheduleValidation(t *testing.T) {
+	tests := []struct {
+		name      string
+		scheduler Scheduler
+		ok        bool
+	}{
+		{"NewStepDecay", NewStepDecay(2), true},
+		{"NewExponentialDecay", NewExponentialDecay(), true},
+		{"NewCosineAnnealing", NewCosineAnnealing(5), true},
+		{"NewOneCycle", NewOneCycle(.1, 100), true},
+		{"NewReduceOnPlateau", NewReduceOnPlateau(), true},
+		{"warmup", &LinearWarmup{Steps: 10}, true},
+		{"warmup into NewStepDecay", &LinearWarmup{Steps: 10, After: NewStepDecay(2)}, true},
+
+		{"step decay gamma 0", &StepDecay{StepSize: 1}, false},
+		{"exponential decay gamma 0", &ExponentialDecay{}, false},
+		{"cosine annealing mult 0", &CosineAnnealing{Period: 5}, false},
+		{"one cycle div factors 0", &OneCycle{MaxRate: .1, TotalSteps: 10, PctStart: .3}, false},
+		{"one cycle max rate 0", &OneCycle{TotalSteps: 10, PctStart: .3, DivFactor: 25, FinalDivFactor: 1e4}, false},
+		{"one cycle pct start 1", &OneCycle{MaxRate: .1, TotalSteps: 10, PctStart: 1, DivFactor: 25, FinalDivFactor: 1e4}, false},
+		{"reduce on plateau factor 0", &ReduceOnPlateau{Patience: 1}, false},
+		{"warmup into gamma 0", &LinearWarmup{Steps: 10, After: &ExponentialDecay{}}, false},
+		{"warmup steps negative", &LinearWarmup{Steps: -1}, false},
+	}
+	for _, test := range tests {
+		output, err := NewLayer(LayerConfig{Neurons: 2, Activation: Softmax})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = NewNetwork(NNConfig{InputNeurons: 2, OutputLayer: output, Scheduler: test.scheduler})
+		if test.ok && err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+		if !test.ok && err == nil {
+			t.Errorf("%s: NewNetwork accepted it", test.name)
+		}
+	}
+}
+
+func TestStepDecay(t *testing.T) {
+	checkRates(t, "NewStepDecay(2)", rates(NewStepDecay(2), 1, 5), []float64{1, 1, .1, .1, .01})
+	checkRates(t, "StepDecay with StepSize 0", rates(&StepDecay{Gamma: .5}, 1, 3), []float64{1, 1, 1})
+}
+
+func TestCosineAnnealing(t *testing.T) {
+	s := NewCosineAnnealing(4)
+	s.MinRate = .2
+	checkRates(t, "CosineAnnealing", rates(s, 1, 9), []float64{
+		1, .2 + .8*(1+math.Cos(math.Pi/4))/2, .6, .2 + .8*(1+math.Cos(3*math.Pi/4))/2,
+		1, .2 + .8*(1+math.Cos(math.Pi/4))/2, .6, .2 + .8*(1+math.Cos(3*math.Pi/4))/2,
+		1,
+	})
+
+	// each cycle twice as long as the last: 2 epochs, then 4, then 8
+	s = &CosineAnnealing{Period: 2, Mult: 2}
+	checkRates(t, "CosineAnnealing with Mult 2", rates(s, 1, 7), []float64{1, .5, 1, .5 + .5*math.Cos(math.Pi/4), .5, .5 - .5*math.Cos(math.Pi/4), 1})
+}
+
+func TestLinearWarmup(t *testing.T) {
+	checkRates(t, "LinearWarmup", rates(&LinearWarmup{Steps: 4}, 2, 6), []float64{.5, 1, 1.5, 2, 2, 2})
+
+	s := &LinearWarmup{Steps: 2, After: &StepDecay{StepSize: 1, Gamma: .5}}
+	checkRates(t, "LinearWarmup into StepDecay", rates(s, 1, 5), []float64{.5, 1, .25, .125, .0625})
+
+	// the loss gets through to a scheduler that wants it
+	plateau := &ReduceOnPlateau{Factor: .5, Patience: 1}
+	s = &LinearWarmup{Steps: 1, After: plateau}
+	s.Observe(0, 1)
+	s.Observe(1, 1)
+	if rate := s.Rate(1, 2, 2); rate != .5 {
+		t.Errorf("LinearWarmup into ReduceOnPlateau gave rate %v after a plateau, want 0.5", rate)
+	}
+}
+
+func TestOneCycle(t *testing.T) {
+	s := NewOneCycle(1, 10)
+	got := rates(s, 123, 12)
+	want := []float64{
+		// warming up over the first 3 steps from 1/25 to 1
+		.04, .04 + .96*(1-math.Cos(math.Pi/3))/2, .04 + .96*(1-math.Cos(2*math.Pi/3))/2,
+		1,
+	}
+	// then annealing over the other 7 to 1/25/1e4, where it stays
+	end := .04 / 1e4
+	for k := 1; k <= 6; k++ {
+		want = append(want, end+(1-end)*(1+math.Cos(math.Pi*float64(k)/7))/2)
+	}
+	want = append(want, end, end)
+	checkRates(t, "OneCycle", got, want)
+}
+
+func TestReduceOnPlateau(t *testing.T) {
+	s := &ReduceOnPlateau{Factor: .5, Patience: 2, MinRate: .2}
+	losses := []float64{1, .9, .9, .9, .8, .8, .8, .8, .8, .8}
+	var got []float64
+	for e, loss := range losses {
+		s.Observe(e, loss)
+		got = append(got, s.Rate(1, e+1, 0))
+	}
+	// cut after each 2 epochs without improvement, down to MinRate
+	checkRates(t, "ReduceOnPlateau", got, []float64{1, 1, 1, .5, .5, .5, .25, .25, .2, .2})
+}
@@ -0,0 +1,134 @@
+package zdnn
+
+import (
+	"fmt"
+	"math/rand"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Shape is the layout of each sample's values: Channels maps of Height rows by
+// Width columns, stored channel by channel and row by row down a column of the
+// batch. A plain vector of n values is Shape{n, 1, 1}
+type Shape struct {
+	Channels int
+	Height   int
+	Width    int
+}
+
+// Size is how many values a sample of this shape has
+func (s Shape) Size() int {
+	return s.Channels * s.Height * s.Width
+}
+
+func (s Shape) String() string {
+	return fmt.Sprintf("%dx%dx%d", s.Channels, s.Height, s.Width)
+}
+
+// flat is the shape of a plain vector of size values
+func flat(size int) Shape {
+	return Shape{Channels: size, Height: 1, Width: 1}
+}
+
+// ShapedLayer is a Layer that needs to know the shape of its input, not just
+// its size, like a convolution. The network calls BuildShape instead of Build,
+// and passes the shape it returns on to the next layer. Layers that aren't
+// ShapedLayers flatten what they're given
+type ShapedLayer interface {
+	Layer
+
+	// BuildShape is Build for inputs of the given shape, returning the shape of the output
+	BuildShape(input Shape, rng *rand.Rand) (Shape, error)
+}
+
+// buildLayer builds layer for input, giving the shape of its output
+func buildLayer(layer Layer, input Shape, rng *rand.Rand) (Shape, error) {
+	if sl, ok := layer.(ShapedLayer); ok {
+		return sl.BuildShape(input, rng)
+	}
+	size, err := layer.Build(input.Size(), rng)
+	return flat(size), err
+}
+
+// Flatten turns image-like input into a plain vector for the dense layers
+// after it. The values themselves are left as they are
+type Flatten struct{}
+
+// NewFlatten builds a Flatten layer
+func NewFlatten() *Flatten {
+	return &Flatten{}
+}
+
+func (f *Flatten) Build(inputSize int, rng *rand.Rand) (int, error) {
+	return inputSize, nil
+}
+
+func (f *Flatten) BuildShape(input Shape, rng *rand.Rand) (Shape, error) {
+	return flat(input.Size()), nil
+}
+
+func (f *Flatten) Forward(input *mat.Dense, mode Mode, rng *rand.Rand) *mat.Dense {
+	return input
+}
+
+func (f *Flatten) Backward(dOutput *mat.Dense) *mat.Dense {
+	return dOutput
+}
+
+func (f *Flatten) Params() []*mat.Dense {
+	return nil
+}
+
+func (f *Flatten) Grads() []*mat.Dense {
+	return nil
+}
+
+func (f *Flatten) Replica() Layer {
+	return f
+}
+
+// Reshape gives its input a new shape with the same number of values, like a
+// plain vector from a dense layer reshaped into maps for a convolution
+type Reshape struct {
+	shape Shape
+}
+
+// NewReshape builds a layer reshaping its input to shape
+func NewReshape(shape Shape) (*Reshape, error) {
+	if shape.Channels < 1 || shape.Height < 1 || shape.Width < 1 {
+		return nil, fmt.Errorf("can't reshape to %v", shape)
+	}
+	return &Reshape{shape: shape}, nil
+}
+
+func (r *Reshape) Build(inputSize int, rng *rand.Rand) (int, error) {
+	s, err := r.BuildShape(flat(inputSize), rng)
+	return s.Size(), err
+}
+
+func (r *Reshape) BuildShape(input Shape, rng *rand.Rand) (Shape, error) {
+	if input.Size() != r.shape.Size() {
+		return Shape{}, fmt.Errorf("can't reshape %v to %v", input, r.shape)
+	}
+	return r.shape, nil
+}
+
+func (r *Reshape) Forward(input *mat.Dense, mode Mode, rng *rand.Rand) *mat.Dense {
+	return input
+}
+
+func (r *Reshape) Backward(dOutput *mat.Dense) *mat.Dense {
+	return dOutput
+}
+
+func (r *Reshape) Params() []*mat.Dense {
+	return nil
+}
+
+func (r *Reshape) Grads() []*mat.Dense {
+	return nil
+}
+
+func (r *Reshape) Replica() Layer {
+	return r
+}